@@ -0,0 +1,224 @@
+package debdep
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+// BuildOptions configures the resolution of the build dependencies of a
+// source package.
+type BuildOptions struct {
+	// HostArch is the architecture the package is built for. If empty, or
+	// the native architecture, the package is built natively. Otherwise, the
+	// package is cross-built, and packages of the host architecture must be
+	// available as a foreign architecture.
+	HostArch string
+	// Profiles lists the active build profiles, such as nocheck or stage1.
+	Profiles []string
+
+	// ArchOnly and IndepOnly limit the build dependencies to those needed
+	// to build the architecture-dependent or architecture-independent
+	// packages respectively, as with apt-get build-dep --arch-only and
+	// --indep-only.
+	ArchOnly, IndepOnly bool
+
+	// ResolveOptions configures how the build dependencies are resolved.
+	ResolveOptions
+}
+
+// buildEssential is the package needed to build any Debian package, which
+// source packages need not declare as a build dependency.
+const buildEssential = "build-essential"
+
+// archMatches returns true if the architecture matches the pattern, which
+// may be an architecture name or a wildcard, such as linux-any or any-amd64.
+func archMatches(pattern, arch string) bool {
+	if pattern == "any" || pattern == arch {
+		return true
+	}
+	patOS, patCPU := splitArch(pattern)
+	archOS, archCPU := splitArch(arch)
+	return (patOS == "any" || patOS == archOS) && (patCPU == "any" || patCPU == archCPU)
+}
+
+// splitArch splits an architecture into its operating system and CPU.
+// Architectures without an operating system prefix run on Linux.
+func splitArch(arch string) (string, string) {
+	if idx := strings.Index(arch, "-"); idx != -1 {
+		return arch[:idx], arch[idx+1:]
+	}
+	return "linux", arch
+}
+
+// restrictionsApply returns true if a relation applies when building for the
+// given architecture with the given build profiles active.
+func restrictionsApply(req deb.Requirement, arch string, profiles map[string]bool) bool {
+	if len(req.ArchRestrictions) > 0 {
+		// Restriction lists are either all negated, or all positive.
+		negated := strings.HasPrefix(req.ArchRestrictions[0], "!")
+		matched := false
+		for _, r := range req.ArchRestrictions {
+			if archMatches(strings.TrimPrefix(r, "!"), arch) {
+				matched = true
+			}
+		}
+		if matched == negated {
+			return false
+		}
+	}
+
+	if len(req.BuildProfiles) == 0 {
+		return true
+	}
+	// The relation applies if any group has all of its terms satisfied.
+	for _, group := range req.BuildProfiles {
+		satisfied := true
+		for _, term := range group {
+			if profiles[strings.TrimPrefix(term, "!")] == strings.HasPrefix(term, "!") {
+				satisfied = false
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// reduceRestrictions removes the relations which do not apply when building
+// for the given architecture with the given build profiles active, as
+// described by the Debian policy for source package relations. Groups of
+// alternatives with no applicable alternative are dropped.
+func reduceRestrictions(req deb.Requirement, arch string, profiles map[string]bool) (deb.Requirement, bool) {
+	switch req.Kind {
+	case deb.PackageRelationRequirement:
+		if !restrictionsApply(req, arch, profiles) {
+			return req, false
+		}
+		req.ArchRestrictions, req.BuildProfiles = nil, nil
+		return req, true
+	}
+
+	out := deb.Requirement{Kind: req.Kind, ArchConstraint: req.ArchConstraint}
+	for _, c := range req.Children {
+		if reduced, ok := reduceRestrictions(c, arch, profiles); ok {
+			out.Children = append(out.Children, reduced)
+		}
+	}
+	if req.Kind == deb.OrCompositeRequirement {
+		switch len(out.Children) {
+		case 0:
+			return out, false
+		case 1:
+			return out.Children[0], true
+		}
+	}
+	return out, true
+}
+
+// BuildDepends returns the build dependencies of the source package which
+// apply to a build with the given options, grouped by the field they were
+// declared in. Relations restricted to other architectures or build
+// profiles are omitted.
+func (p *PackageInfo) BuildDepends(src *deb.Paragraph, opts BuildOptions) (map[string]deb.Requirement, error) {
+	hostArch := opts.HostArch
+	if hostArch == "" {
+		hostArch = p.Config.Arch.Arch
+	}
+	profiles := map[string]bool{}
+	for _, profile := range opts.Profiles {
+		profiles[profile] = true
+	}
+
+	fields := []string{"Build-Depends"}
+	if !opts.IndepOnly {
+		fields = append(fields, "Build-Depends-Arch")
+	}
+	if !opts.ArchOnly {
+		fields = append(fields, "Build-Depends-Indep")
+	}
+
+	out := map[string]deb.Requirement{}
+	for _, field := range fields {
+		spec, ok := src.Values[field]
+		if !ok {
+			continue
+		}
+		rel, err := deb.ParsePackageRelations(spec, "")
+		if err != nil {
+			return nil, err
+		}
+		if rel, ok = reduceRestrictions(rel, hostArch, profiles); ok {
+			out[field] = rel
+		}
+	}
+	return out, nil
+}
+
+// BuildDepsGraph computes the operations necessary to install the build
+// dependencies of the source package, similar to apt-get build-dep. The
+// receiver describes the binary packages available, and installed the
+// packages already installed. As with apt, build-essential is included
+// if available.
+//
+// When cross-building, build dependencies are satisfied by packages of the
+// host architecture, unless they are Multi-Arch: foreign or qualified
+// with :native, in which case they run on the build (native) architecture.
+func (p *PackageInfo) BuildDepsGraph(src *deb.Paragraph, installed *PackageInfo, opts BuildOptions) (*Operation, error) {
+	return p.BuildDepsGraphContext(context.Background(), src, installed, opts)
+}
+
+// BuildDepsGraphContext is like BuildDepsGraph, but resolution is abandoned
+// with an ErrLimit if ctx is done or a limit set in opts is exceeded.
+func (p *PackageInfo) BuildDepsGraphContext(ctx context.Context, src *deb.Paragraph, installed *PackageInfo, opts BuildOptions) (*Operation, error) {
+	if installed == nil {
+		installed = &PackageInfo{}
+	}
+	deps, err := p.BuildDepends(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	v, err := src.Version()
+	if err != nil {
+		return nil, err
+	}
+	hostArch := opts.HostArch
+	if hostArch == "" {
+		hostArch = p.Config.Arch.Arch
+	}
+
+	state, cancel := newResolveState(ctx, installed, opts.ResolveOptions)
+	defer cancel()
+	out := &Operation{Kind: CompositeDependencyOp}
+	essential := deb.Requirement{
+		Kind:           deb.PackageRelationRequirement,
+		Package:        buildEssential,
+		ArchConstraint: deb.Arch{Native: true},
+	}
+	if _, err := p.findRelation(essential, ""); err == nil {
+		op, err := p.buildInstallGraphRequirement(state, essential, "", nil, false)
+		if err != nil {
+			return nil, err
+		}
+		out.DependentOperations = append(out.DependentOperations, op)
+	} else if err != os.ErrNotExist {
+		return nil, err
+	}
+
+	for _, field := range []string{"Build-Depends", "Build-Depends-Arch", "Build-Depends-Indep"} {
+		rel, ok := deps[field]
+		if !ok {
+			continue
+		}
+		chain := extendChain(nil, src.Name(), v, field, rel)
+		op, err := p.buildInstallGraphRequirement(state, rel, hostArch, chain, false)
+		if err != nil {
+			return nil, err
+		}
+		out.DependentOperations = append(out.DependentOperations, op)
+	}
+	return out, nil
+}
@@ -0,0 +1,88 @@
+package debdep
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+func TestArchMatches(t *testing.T) {
+	tcs := []struct {
+		pattern, arch string
+		want          bool
+	}{
+		{"amd64", "amd64", true},
+		{"amd64", "i386", false},
+		{"any", "arm64", true},
+		{"linux-any", "arm64", true},
+		{"linux-any", "hurd-i386", false},
+		{"hurd-any", "hurd-i386", true},
+		{"any-i386", "hurd-i386", true},
+		{"any-i386", "i386", true},
+		{"any-amd64", "i386", false},
+	}
+	for _, tc := range tcs {
+		if got := archMatches(tc.pattern, tc.arch); got != tc.want {
+			t.Errorf("archMatches(%q, %q) = %v, want %v", tc.pattern, tc.arch, got, tc.want)
+		}
+	}
+}
+
+func TestBuildDepsGraph(t *testing.T) {
+	conf := ResolverConfig{
+		Arch:          deb.Arch{Arch: "amd64"},
+		ForeignArches: []string{"arm64"},
+	}
+	pkgs := makeConfiguredPkgInfo(t, conf,
+		map[string]string{"Package": "build-essential", "Version": "12.6", "Architecture": "amd64"},
+		map[string]string{"Package": "debhelper", "Version": "12.1", "Architecture": "all", "Multi-Arch": "foreign"},
+		// Build tools published for both architectures must run on the
+		// build machine, so the native one is chosen when cross-building.
+		map[string]string{"Package": "make", "Version": "4.2", "Architecture": "amd64", "Multi-Arch": "foreign"},
+		map[string]string{"Package": "make", "Version": "4.2", "Architecture": "arm64", "Multi-Arch": "foreign"},
+		map[string]string{"Package": "libfoo-dev", "Version": "1.0", "Architecture": "amd64", "Multi-Arch": "same"},
+		map[string]string{"Package": "libfoo-dev", "Version": "1.0", "Architecture": "arm64", "Multi-Arch": "same"},
+		map[string]string{"Package": "check", "Version": "0.12", "Architecture": "amd64"},
+		map[string]string{"Package": "pkg-config", "Version": "0.29", "Architecture": "amd64"},
+		map[string]string{"Package": "doc-tool", "Version": "1.0", "Architecture": "all"},
+	)
+	src := &deb.Paragraph{Values: map[string]string{
+		"Package":             "foo",
+		"Version":             "1.0-1",
+		"Architecture":        "any all",
+		"Build-Depends":       "debhelper (>= 11), make, libfoo-dev, check <!nocheck>, mingw-w64 [mingw-any], pkg-config:native",
+		"Build-Depends-Indep": "doc-tool",
+	}}
+
+	tcs := []struct {
+		name string
+		opts BuildOptions
+		want []string
+	}{
+		{
+			name: "native",
+			want: []string{"build-essential", "debhelper", "make", "libfoo-dev", "check", "pkg-config", "doc-tool"},
+		},
+		{
+			name: "cross",
+			opts: BuildOptions{HostArch: "arm64", Profiles: []string{"nocheck"}, ArchOnly: true},
+			want: []string{"build-essential", "debhelper", "make", "libfoo-dev:arm64", "pkg-config"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			graph, err := pkgs.BuildDepsGraph(src, nil, tc.opts)
+			if err != nil {
+				t.Fatalf("BuildDepsGraph() failed: %v", err)
+			}
+			var got []string
+			for _, op := range graph.Unroll() {
+				got = append(got, op.Package)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("BuildDepsGraph() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package debdep
+
+import (
+	"strings"
+
+	"github.com/twitchyliquid64/debdep/deb"
+
+	version "github.com/knqyf263/go-deb-version"
+)
+
+// BrokenRelation is a relation of an installed package which is not met by
+// the installed packages.
+type BrokenRelation struct {
+	// Field is Pre-Depends or Depends for relations which are not
+	// satisfied, and Breaks or Conflicts for relations matching an
+	// installed package.
+	Field    string
+	Relation deb.Requirement
+	// Packages lists the installed packages matched by a Breaks or
+	// Conflicts relation.
+	Packages []string
+	// Installed lists the installed versions of the package named by an
+	// unsatisfied relation, which do not meet its constraints.
+	Installed []string
+	// Unconfigured lists the packages satisfying a Pre-Depends relation,
+	// none of which are fully installed, as Pre-Depends must be
+	// configured.
+	Unconfigured []string
+}
+
+// String describes the relation, in the style of apt.
+func (r BrokenRelation) String() string {
+	if len(r.Unconfigured) > 0 {
+		return r.Field + ": " + r.Relation.String() + " but " + strings.Join(r.Unconfigured, ", ") + " is not configured"
+	}
+	if len(r.Packages) == 0 {
+		if len(r.Installed) > 0 {
+			return r.Field + ": " + r.Relation.String() + " but " + strings.Join(r.Installed, ", ") + " is installed"
+		}
+		return r.Field + ": " + r.Relation.String() + " but it is not installed"
+	}
+	return r.Field + ": " + r.Relation.String() + " but " + strings.Join(r.Packages, ", ") + " is installed"
+}
+
+// BrokenPackage describes an installed package which is inconsistent with
+// the rest of the installed packages, or which dpkg did not finish
+// installing.
+type BrokenPackage struct {
+	// Package is the name the package is stored under in
+	// PackageInfo.Packages.
+	Package string
+	Version version.Version
+	// State is the package state from its Status field, such as
+	// half-configured, if the package is not fully installed.
+	State     string
+	Relations []BrokenRelation
+}
+
+// CheckConsistency verifies the installed packages described by the
+// receiver, similar to apt-get check. It returns the packages whose
+// Pre-Depends or Depends are not satisfied, whose Breaks or Conflicts match
+// another installed package, or which are not fully installed, sorted by
+// name. Pre-Depends are only satisfied by packages which are fully
+// installed.
+func (p *PackageInfo) CheckConsistency() ([]BrokenPackage, error) {
+	installed, err := installedSet(p)
+	if err != nil {
+		return nil, err
+	}
+	broken, err := installed.broken()
+	if err != nil {
+		return nil, err
+	}
+	missing := map[string][]brokenPackage{}
+	for _, b := range broken {
+		missing[b.Package] = append(missing[b.Package], b)
+	}
+
+	var out []BrokenPackage
+	for _, name := range installed.names() {
+		pkg := installed.pkgs[name]
+		v, err := pkg.Version()
+		if err != nil {
+			return nil, err
+		}
+		check := BrokenPackage{Package: name, Version: v, State: incompleteState(pkg)}
+		for _, b := range missing[name] {
+			for _, rel := range b.Missing {
+				installedVersions, err := installed.versionsOf(rel)
+				if err != nil {
+					return nil, err
+				}
+				check.Relations = append(check.Relations, BrokenRelation{Field: b.Field, Relation: rel, Installed: installedVersions})
+			}
+		}
+
+		unconfigured, err := installed.unconfiguredPreDepends(pkg)
+		if err != nil {
+			return nil, err
+		}
+		check.Relations = append(check.Relations, unconfigured...)
+
+		violations, err := installed.violations(pkg)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range violations {
+			// Several packages may match the same relation.
+			if n := len(check.Relations); n > 0 && check.Relations[n-1].Field == v.Field && check.Relations[n-1].Relation.Equal(&v.Relation) {
+				check.Relations[n-1].Packages = append(check.Relations[n-1].Packages, v.Victim)
+				continue
+			}
+			check.Relations = append(check.Relations, BrokenRelation{Field: v.Field, Relation: v.Relation, Packages: []string{v.Victim}})
+		}
+
+		if check.State != "" || len(check.Relations) > 0 {
+			out = append(out, check)
+		}
+	}
+	return out, nil
+}
+
+// unconfiguredPreDepends returns the Pre-Depends relations of pkg which are
+// only satisfied by packages in the set which are not fully installed.
+// Relations which are not satisfied at all are reported by broken.
+func (s *pkgSet) unconfiguredPreDepends(pkg *deb.Paragraph) ([]BrokenRelation, error) {
+	spec, ok := pkg.Values["Pre-Depends"]
+	if !ok {
+		return nil, nil
+	}
+	rel, err := deb.ParsePackageRelations(spec, pkg.Arch())
+	if err != nil {
+		return nil, err
+	}
+
+	var out []BrokenRelation
+	for _, group := range relationGroups(rel) {
+		if group.Kind == deb.AndCompositeRequirement && len(group.Children) == 0 {
+			continue
+		}
+		matches, err := s.satisfiers(group, effectiveArch(pkg, s.native))
+		if err != nil {
+			return nil, err
+		}
+		var unconfigured []string
+		for _, m := range matches {
+			if incompleteState(s.pkgs[m]) == "" {
+				unconfigured = nil
+				break
+			}
+			unconfigured = append(unconfigured, m)
+		}
+		if len(unconfigured) > 0 {
+			out = append(out, BrokenRelation{Field: "Pre-Depends", Relation: group, Unconfigured: unconfigured})
+		}
+	}
+	return out, nil
+}
+
+// versionsOf returns the versions of the installed packages named by a
+// package relation.
+func (s *pkgSet) versionsOf(rel deb.Requirement) ([]string, error) {
+	if rel.Kind != deb.PackageRelationRequirement {
+		return nil, nil
+	}
+	var out []string
+	for _, name := range s.byName[rel.Package] {
+		pkg, ok := s.pkgs[name]
+		if !ok {
+			continue
+		}
+		v, err := pkg.Version()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v.String())
+	}
+	return out, nil
+}
+
+// incompleteState returns the state of a package which dpkg has not
+// finished installing or configuring, such as unpacked or half-configured,
+// or the empty string if the package is installed.
+func incompleteState(pkg *deb.Paragraph) string {
+	status := strings.Fields(pkg.Values["Status"])
+	if len(status) != 3 {
+		return ""
+	}
+	switch status[2] {
+	case "installed", "triggers-awaited", "triggers-pending":
+		return ""
+	}
+	return status[2]
+}
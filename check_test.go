@@ -0,0 +1,43 @@
+package debdep
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	installed := makePkgInfo(t,
+		map[string]string{"Package": "app", "Version": "1", "Depends": "lib (>= 2), mail | postfix", "Pre-Depends": "base"},
+		map[string]string{"Package": "lib", "Version": "1", "Status": "install ok installed"},
+		map[string]string{"Package": "base", "Version": "1", "Status": "install ok half-configured"},
+		map[string]string{"Package": "exim", "Version": "1", "Provides": "mta", "Conflicts": "mta"},
+		map[string]string{"Package": "sendmail", "Version": "1", "Provides": "mta", "Breaks": "exim (<< 2)"},
+		map[string]string{"Package": "ok", "Version": "1", "Depends": "lib", "Conflicts": "gone"},
+		map[string]string{"Package": "gone", "Version": "1", "Status": "deinstall ok config-files"},
+	)
+
+	broken, err := installed.CheckConsistency()
+	if err != nil {
+		t.Fatalf("CheckConsistency() returned err: %v", err)
+	}
+	got := map[string][]string{}
+	for _, b := range broken {
+		var relations []string
+		if b.State != "" {
+			relations = append(relations, "state "+b.State)
+		}
+		for _, r := range b.Relations {
+			relations = append(relations, r.String())
+		}
+		got[b.Package] = relations
+	}
+	want := map[string][]string{
+		"app":      {"Depends: lib (>= 2) but 1 is installed", "Depends: mail | postfix but it is not installed", "Pre-Depends: base but base is not configured"},
+		"base":     {"state half-configured"},
+		"exim":     {"Conflicts: mta but sendmail is installed"},
+		"sendmail": {"Breaks: exim (<< 2) but exim is installed"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckConsistency() = %q, want %q", got, want)
+	}
+}
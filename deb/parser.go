@@ -71,8 +71,6 @@ func (d *Decoder) Decode(out *Paragraph) error {
 			lastMultiline = multilineFields[lastKey]
 		}
 	}
-
-	return nil
 }
 
 // NewDecoder returns a decoder for reading debian control files and
@@ -108,8 +106,6 @@ func readPkgSpec(r *bufio.Reader) (string, error) {
 		}
 		out += string(inRune)
 	}
-
-	return "", nil
 }
 
 func parseArch(in string) (Arch, error) {
@@ -119,64 +115,107 @@ func parseArch(in string) (Arch, error) {
 	if in == "any" {
 		return Arch{Any: true}, nil
 	}
+	if in == "native" {
+		return Arch{Native: true}, nil
+	}
 	if idx := strings.Index(in, "-"); idx != -1 {
 		return Arch{
 			OS:   in[:idx],
 			Arch: in[idx+1:],
 		}, nil
 	}
-	return Arch{}, nil
+	return Arch{Arch: in}, nil
 }
 
-// parseRelation parses a single package name & optional version constraint.
-func parseRelation(r *bufio.Reader) (string, *VersionConstraint, *Arch, error) {
+// parseRelation parses a single package name, with an optional version
+// constraint, architecture restriction list, and build profile restrictions.
+func parseRelation(r *bufio.Reader) (Requirement, error) {
+	out := Requirement{Kind: PackageRelationRequirement}
 	if err := consumeWhitespace(r); err != nil {
-		return "", nil, nil, err
+		return out, err
 	}
 	spec, err := readPkgSpec(r)
 	if err != nil && err != io.EOF {
-		return spec, nil, nil, err
+		return out, err
 	}
 
-	var arch Arch
-	name := spec
+	out.Package = spec
 	archDelim := strings.Index(spec, ":")
 	if archDelim != -1 {
-		if arch, err = parseArch(spec[archDelim+1:]); err != nil {
-			return "", nil, nil, err
+		if out.ArchConstraint, err = parseArch(spec[archDelim+1:]); err != nil {
+			return out, err
 		}
-		name = spec[:archDelim]
+		out.Package = spec[:archDelim]
 	}
 
-	consumeWhitespace(r)
-	next, _, err := r.ReadRune()
-	if err != nil && err != io.EOF {
-		return name, nil, nil, err
+	// readNext consumes the next non-whitespace rune, noting the end of input.
+	var next rune
+	atEOF := false
+	readNext := func() error {
+		consumeWhitespace(r)
+		var err error
+		if next, _, err = r.ReadRune(); err == io.EOF {
+			atEOF = true
+			return nil
+		}
+		return err
 	}
-	if next != '(' {
-		r.UnreadRune()
-		return name, nil, &arch, err
+
+	if err := readNext(); err != nil {
+		return out, err
 	}
+	if next == '(' {
+		var versionConst VersionConstraint
+		constraint, err := r.ReadString(' ')
+		if err != nil {
+			return out, fmt.Errorf("error when expected ' ': %v", err)
+		}
+		constraint = strings.Trim(constraint, " ")
+		switch constraint {
+		case ConstraintGreaterThan, ConstraintLessThan, ConstraintEquals, ConstraintGreaterEquals, ConstraintLessThanEquals:
+			versionConst.ConstraintRelation = ConstraintRelation(constraint)
+		default:
+			return out, fmt.Errorf("expected relation, got %q", constraint)
+		}
 
-	var versionConst VersionConstraint
-	constraint, err := r.ReadString(' ')
-	if err != nil {
-		return name, nil, nil, fmt.Errorf("error when expected ' ': %v", err)
+		vers, err := r.ReadString(')')
+		if err != nil {
+			return out, fmt.Errorf("error when expected ')': %v", err)
+		}
+		versionConst.Version = strings.Trim(vers, ") ")
+		out.VersionConstraint = &versionConst
+		if err := readNext(); err != nil {
+			return out, err
+		}
 	}
-	constraint = strings.Trim(constraint, " ")
-	switch constraint {
-	case ConstraintGreaterThan, ConstraintLessThan, ConstraintEquals, ConstraintGreaterEquals, ConstraintLessThanEquals:
-		versionConst.ConstraintRelation = ConstraintRelation(constraint)
-	default:
-		return name, nil, nil, fmt.Errorf("expected relation, got %q", constraint)
+
+	// Relations in source packages may be restricted to some architectures
+	// and build profiles, such as "foo [amd64 i386] <!nocheck>".
+	if next == '[' {
+		list, err := r.ReadString(']')
+		if err != nil {
+			return out, fmt.Errorf("error when expected ']': %v", err)
+		}
+		out.ArchRestrictions = strings.Fields(strings.TrimSuffix(list, "]"))
+		if err := readNext(); err != nil {
+			return out, err
+		}
+	}
+	for next == '<' {
+		list, err := r.ReadString('>')
+		if err != nil {
+			return out, fmt.Errorf("error when expected '>': %v", err)
+		}
+		out.BuildProfiles = append(out.BuildProfiles, strings.Fields(strings.TrimSuffix(list, ">")))
+		if err := readNext(); err != nil {
+			return out, err
+		}
 	}
 
-	vers, err := r.ReadString(')')
-	if err != nil {
-		return name, nil, nil, fmt.Errorf("error when expected ')': %v", err)
+	if atEOF {
+		return out, io.EOF
 	}
-	versionConst.Version = strings.Trim(vers, ") ")
-	return name, &versionConst, &arch, nil
+	return out, r.UnreadRune()
 }
 
 // parseRelationSpec parses a group (between commas) of relation constraints.
@@ -188,20 +227,12 @@ func parseRelationSpec(r *bufio.Reader) (out Requirement, err error) {
 	}()
 
 	for {
-		name, versionConst, arch, err := parseRelation(r)
+		spec, err := parseRelation(r)
 		if err != nil {
-			if err != io.EOF || name == "" {
+			if err != io.EOF || spec.Package == "" {
 				return out, err
 			}
 		}
-		spec := Requirement{
-			Kind:           PackageRelationRequirement,
-			Package:        name,
-			ArchConstraint: *arch,
-		}
-		if versionConst != nil {
-			spec.VersionConstraint = versionConst
-		}
 
 		consumeWhitespace(r)
 		next, _, err := r.ReadRune()
@@ -234,8 +265,6 @@ func parseRelationSpec(r *bufio.Reader) (out Requirement, err error) {
 			}
 		}
 	}
-
-	return out, nil
 }
 
 // ParsePackageRelations takes a string of package/version contraints, and parses
@@ -276,6 +305,4 @@ func ParsePackageRelations(in, arch string) (out Requirement, err error) {
 		}
 		out.Children = append(out.Children, spec)
 	}
-
-	return out, nil
 }
@@ -61,6 +61,12 @@ func TestBasic(t *testing.T) {
 	if p.Values["Version"] != "1.500-1" {
 		t.Errorf("Version = %q, wanted %q", p.Values["Version"], "1.500-1")
 	}
+	if size, err := p.InstalledSize(); err != nil || size != 2208*1024 {
+		t.Errorf("InstalledSize() = %d, %v, wanted %d", size, err, 2208*1024)
+	}
+	if size, err := p.Size(); err != nil || size != 0 {
+		t.Errorf("Size() = %d, %v, wanted 0 as the field is absent", size, err)
+	}
 	if len(p.Values["Description"]) != 1304 {
 		t.Errorf("len(Description) = %d, wanted %d", len(p.Values["Description"]), 1304)
 	}
@@ -73,7 +79,7 @@ func TestBasic(t *testing.T) {
 var longDepends = `libamd2 (>= 1:4.5.2), libavcodec58 | libavcodec-extra58, libavformat58, libavutil56, libblas3 | libblas.so.3, libbtf1 (>= 1:4.5.2), libc6 (>= 2.15), libccolamd2 (>= 1:4.5.2), libcholmod3 (>= 1:4.5.2), libcolamd2 (>= 1:4.5.2), libcxsparse3 (>= 1:4.5.2), libgcc1 (>= 1:4.0), libjpeg62-turbo (>= 1.3.1), libklu1 (>= 1:4.5.2), liblapack3 | liblapack.so.3, libldl2 (>= 1:4.5.2), libopencv-calib3d3.2, libopencv-contrib3.2, libopencv-core3.2, libopencv-features2d3.2, libopencv-flann3.2, libopencv-highgui3.2, libopencv-imgcodecs3.2, libopencv-imgproc3.2, libopencv-ml3.2, libopencv-objdetect3.2, libopencv-photo3.2, libopencv-shape3.2, libopencv-stitching3.2, libopencv-superres3.2, libopencv-video3.2, libopencv-videoio3.2, libopencv-videostab3.2, libopencv-viz3.2, libspqr2 (>= 1:5.2.0+dfsg), libstdc++6 (>= 5.2), libswscale5 (>= 7:4.0), libumfpack5 (>= 1:4.5.2), libwxbase3.0-0v5 (>= 3.0.4+dfsg), libwxgtk3.0-0v5 (>= 3.0.4+dfsg), zlib1g (>= 1:1.2.3.4)`
 
 func TestComplexDepends(t *testing.T) {
-	spec, err := ParsePackageRelations(longDepends)
+	spec, err := ParsePackageRelations(longDepends, "")
 	if err != nil {
 		t.Fatalf("ParsePackageRelations() returned err: %v", err)
 	}
@@ -83,7 +89,7 @@ func TestComplexDepends(t *testing.T) {
 }
 
 func TestParseDependsSimple(t *testing.T) {
-	spec, err := ParsePackageRelations("libamd2 , libavcodec58")
+	spec, err := ParsePackageRelations("libamd2 , libavcodec58", "")
 	if err != nil {
 		t.Fatalf("ParsePackageRelations() returned err: %v", err)
 	}
@@ -105,7 +111,7 @@ func TestParseDependsSimple(t *testing.T) {
 }
 
 func TestParseDependsSimpleVersions(t *testing.T) {
-	spec, err := ParsePackageRelations("libamd2 (>= 1:4.5.2), libc6 (>= 2.15)")
+	spec, err := ParsePackageRelations("libamd2 (>= 1:4.5.2), libc6 (>= 2.15)", "")
 	if err != nil {
 		t.Fatalf("ParsePackageRelations() returned err: %v", err)
 	}
@@ -122,7 +128,7 @@ func TestParseDependsSimpleVersions(t *testing.T) {
 }
 
 func TestParseDependsSimpleOrWithVersion(t *testing.T) {
-	spec, err := ParsePackageRelations("libamd2 (>= 1:4.5.2) | libc6")
+	spec, err := ParsePackageRelations("libamd2 (>= 1:4.5.2) | libc6", "")
 	if err != nil {
 		t.Fatalf("ParsePackageRelations() returned err: %v", err)
 	}
@@ -139,7 +145,7 @@ func TestParseDependsSimpleOrWithVersion(t *testing.T) {
 }
 
 func TestParseDependsSimpleVersions2(t *testing.T) {
-	spec, err := ParsePackageRelations("kek (<< 1.7), meep (= 1.3.2)")
+	spec, err := ParsePackageRelations("kek (<< 1.7), meep (= 1.3.2)", "")
 	if err != nil {
 		t.Fatalf("ParsePackageRelations() returned err: %v", err)
 	}
@@ -156,7 +162,7 @@ func TestParseDependsSimpleVersions2(t *testing.T) {
 }
 
 func TestParseDependsOrVersions(t *testing.T) {
-	spec, err := ParsePackageRelations("libamd2 (= 1:4.5.2), libkek | libc6 (>= 2.15), bruv")
+	spec, err := ParsePackageRelations("libamd2 (= 1:4.5.2), libkek | libc6 (>= 2.15), bruv", "")
 	if err != nil {
 		t.Fatalf("ParsePackageRelations() returned err: %v", err)
 	}
@@ -188,3 +194,29 @@ func TestParseDependsOrVersions(t *testing.T) {
 		t.Errorf("Last package wrong: %+v", spec.Children[2])
 	}
 }
+
+func TestParseDependsRestrictions(t *testing.T) {
+	spec, err := ParsePackageRelations("debhelper (>= 11), libc6-dev [!hurd-any] <!stage1>, check <!nocheck> <cross>, gcc-mingw | clang [amd64 i386]", "")
+	if err != nil {
+		t.Fatalf("ParsePackageRelations() returned err: %v", err)
+	}
+
+	if len(spec.Children) != 4 {
+		t.Fatalf("Expected 4 children, got %d", len(spec.Children))
+	}
+	if got := spec.Children[0]; got.VersionConstraint == nil || got.ArchRestrictions != nil || got.BuildProfiles != nil {
+		t.Errorf("First relation incorrect: %+v", got)
+	}
+	if got := spec.Children[1]; !reflect.DeepEqual(got.ArchRestrictions, []string{"!hurd-any"}) || !reflect.DeepEqual(got.BuildProfiles, [][]string{{"!stage1"}}) {
+		t.Errorf("Second relation incorrect: %+v", got)
+	}
+	if got := spec.Children[2]; got.Package != "check" || !reflect.DeepEqual(got.BuildProfiles, [][]string{{"!nocheck"}, {"cross"}}) {
+		t.Errorf("Third relation incorrect: %+v", got)
+	}
+	if got := spec.Children[3]; got.Kind != OrCompositeRequirement || len(got.Children) != 2 || !reflect.DeepEqual(got.Children[1].ArchRestrictions, []string{"amd64", "i386"}) {
+		t.Errorf("Fourth relation incorrect: %+v", got)
+	}
+	if got, want := spec.String(), "debhelper (>= 11), libc6-dev [!hurd-any] <!stage1>, check <!nocheck> <cross>, gcc-mingw | clang [amd64 i386]"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
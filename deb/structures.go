@@ -2,6 +2,8 @@ package deb
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 
 	version "github.com/knqyf263/go-deb-version"
@@ -59,9 +61,28 @@ func (p *Paragraph) BinaryPreDepends() (Requirement, error) {
 }
 
 // Provides returns a list of virtual packages this concrete package
-// provides.
+// provides. Any versions given for the virtual packages are omitted.
 func (p *Paragraph) Provides() []string {
-	return strings.Split(strings.Replace(p.Values["Provides"], " ", "", -1), ",")
+	var out []string
+	for _, provides := range strings.Split(p.Values["Provides"], ",") {
+		if idx := strings.Index(provides, "("); idx != -1 {
+			provides = provides[:idx]
+		}
+		if provides = strings.TrimSpace(provides); provides != "" {
+			out = append(out, provides)
+		}
+	}
+	return out
+}
+
+// IsInstalled returns false if the package is described in a dpkg status
+// file as not installed, or only having its configuration files present.
+func (p *Paragraph) IsInstalled() bool {
+	status := strings.Fields(p.Values["Status"])
+	if len(status) != 3 {
+		return true
+	}
+	return status[2] != "not-installed" && status[2] != "config-files"
 }
 
 // Arch returns the architecture of the package.
@@ -69,6 +90,32 @@ func (p *Paragraph) Arch() string {
 	return p.Values["Architecture"]
 }
 
+// InstalledSize returns the disk space used by the installed package, in
+// bytes. The Installed-Size field is given in KiB. 0 is returned if the
+// field is absent.
+func (p *Paragraph) InstalledSize() (int64, error) {
+	kib, err := p.sizeField("Installed-Size")
+	return kib * 1024, err
+}
+
+// Size returns the size of the package file, in bytes. 0 is returned if
+// the field is absent.
+func (p *Paragraph) Size() (int64, error) {
+	return p.sizeField("Size")
+}
+
+func (p *Paragraph) sizeField(field string) (int64, error) {
+	v, ok := p.Values[field]
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q for package %q", field, v, p.Name())
+	}
+	return n, nil
+}
+
 // ForeignDepSatisfiable returns true if the package can satisfy
 // dependencies where the relying package is of a different architecture.
 func (p *Paragraph) ForeignDepSatisfiable() bool {
@@ -131,6 +178,13 @@ type Requirement struct {
 	Package           string
 	VersionConstraint *VersionConstraint
 	ArchConstraint    Arch
+
+	// ArchRestrictions and BuildProfiles limit relations in source
+	// packages to some architectures, such as [amd64 !i386], and build
+	// profiles, such as <!nocheck>. Each entry of BuildProfiles is one
+	// <...> group of terms.
+	ArchRestrictions []string
+	BuildProfiles    [][]string
 }
 
 func (r *Requirement) Equal(b *Requirement) bool {
@@ -138,7 +192,7 @@ func (r *Requirement) Equal(b *Requirement) bool {
 		return false
 	}
 	if r.Kind == PackageRelationRequirement {
-		if r.Package != b.Package {
+		if r.Package != b.Package || r.ArchConstraint != b.ArchConstraint {
 			return false
 		}
 		hasVers := r.VersionConstraint != nil
@@ -190,6 +244,8 @@ type VersionConstraint struct {
 type Arch struct {
 	Any      bool
 	OS, Arch string
+	// Native is set when a relation is qualified with :native.
+	Native bool
 }
 
 func (a Arch) String() string {
@@ -204,3 +260,63 @@ func (a Arch) String() string {
 		return a.OS + "-" + a.Arch
 	}
 }
+
+// Satisfied returns true if the given version meets the constraint.
+func (c *VersionConstraint) Satisfied(v version.Version) (bool, error) {
+	want, err := version.NewVersion(c.Version)
+	if err != nil {
+		return false, err
+	}
+	switch c.ConstraintRelation {
+	case ConstraintEquals:
+		return v.Equal(want), nil
+	case ConstraintLessThan:
+		return v.LessThan(want), nil
+	case ConstraintGreaterThan:
+		return v.GreaterThan(want), nil
+	case ConstraintLessThanEquals:
+		return v.LessThan(want) || v.Equal(want), nil
+	case ConstraintGreaterEquals:
+		return v.GreaterThan(want) || v.Equal(want), nil
+	}
+	return false, fmt.Errorf("unknown constraint relation %q", c.ConstraintRelation)
+}
+
+// String returns the requirement in the syntax used by debian control files.
+func (r Requirement) String() string {
+	switch r.Kind {
+	case PackageRelationRequirement:
+		out := r.Package
+		switch {
+		case r.ArchConstraint.Any:
+			out += ":any"
+		case r.ArchConstraint.Native:
+			out += ":native"
+		case r.ArchConstraint.Arch != "" && r.ArchConstraint.OS == "":
+			out += ":" + r.ArchConstraint.Arch
+		case r.ArchConstraint.Arch != "":
+			out += ":" + r.ArchConstraint.String()
+		}
+		if r.VersionConstraint != nil {
+			out += " (" + string(r.VersionConstraint.ConstraintRelation) + " " + r.VersionConstraint.Version + ")"
+		}
+		if len(r.ArchRestrictions) > 0 {
+			out += " [" + strings.Join(r.ArchRestrictions, " ") + "]"
+		}
+		for _, group := range r.BuildProfiles {
+			out += " <" + strings.Join(group, " ") + ">"
+		}
+		return out
+	case OrCompositeRequirement, AndCompositeRequirement:
+		sep := ", "
+		if r.Kind == OrCompositeRequirement {
+			sep = " | "
+		}
+		parts := make([]string, len(r.Children))
+		for i, c := range r.Children {
+			parts[i] = c.String()
+		}
+		return strings.Join(parts, sep)
+	}
+	return "?"
+}
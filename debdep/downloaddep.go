@@ -9,13 +9,11 @@ import (
 	"net/http"
 	"os"
 	"path"
-	"strings"
 	"sync"
 	"time"
 
 	version "github.com/knqyf263/go-deb-version"
 	"github.com/twitchyliquid64/debdep"
-	"github.com/twitchyliquid64/debdep/deb"
 )
 
 var tr = &http.Transport{
@@ -32,40 +30,18 @@ var tr = &http.Transport{
 	DisableCompression:    false,
 }
 
-func multitargetInstallGraph(pkgs, installed *debdep.PackageInfo, targets []string) ([]debdep.Operation, error) {
-	var debOps []debdep.Operation
-	for _, pkg := range targets {
-		isInstalled, err := installed.HasPackage(deb.Requirement{Kind: deb.PackageRelationRequirement, Package: pkg})
-		if err != nil {
-			return nil, err
-		}
-		if !isInstalled {
-			graph, err := pkgs.InstallGraph(pkg, installed)
-			if err != nil {
-				return nil, err
-			}
-			newOps := graph.Unroll()
-			for _, op := range newOps {
-				installed.AddPkg(&deb.Paragraph{
-					Values: map[string]string{
-						"Package": op.Package,
-						"Version": op.Version.String(),
-					},
-				})
-			}
-			debOps = append(debOps, newOps...)
-		}
-	}
-	return debOps, nil
-}
-
 type downloadWork struct {
 	OutPath string
 	Package string
 	Version version.Version
+
+	// Result is where the outcome of the download is recorded.
+	Result *downloadOutput
 }
 
-func downloadFile(tr *http.Transport, url, outPath, md5 string) error {
+// downloadFile fetches url to outPath, returning true if the server reported
+// the file was not modified since it was last downloaded.
+func downloadFile(tr *http.Transport, url, outPath, md5 string) (bool, error) {
 	client := &http.Client{
 		Transport: tr,
 		Timeout:   45 * time.Second,
@@ -73,7 +49,7 @@ func downloadFile(tr *http.Transport, url, outPath, md5 string) error {
 
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if md5 != "" {
@@ -82,27 +58,26 @@ func downloadFile(tr *http.Transport, url, outPath, md5 string) error {
 
 	r, err := client.Do(req)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer r.Body.Close()
 
 	switch r.StatusCode {
 	case http.StatusNotModified:
-		fmt.Printf("[304] %s is not modified, skipping", path.Base(outPath))
-		return nil
+		return true, nil
 	case http.StatusOK:
 	default:
-		return fmt.Errorf("unexpected response code '%d' (%s)", r.StatusCode, r.Status)
+		return false, fmt.Errorf("unexpected response code '%d' (%s)", r.StatusCode, r.Status)
 	}
 
 	f, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0655)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer f.Close()
 
 	_, err = io.Copy(f, r.Body)
-	return err
+	return false, err
 }
 
 func md5IfExists(path string) string {
@@ -122,74 +97,89 @@ func md5IfExists(path string) string {
 func downloadWorker(wg *sync.WaitGroup, work chan downloadWork, pkgs *debdep.PackageInfo, tr *http.Transport) {
 	defer wg.Done()
 	for dl := range work {
-		fmt.Printf("Downloading: %v (%v)\n", dl.Package, dl.Version.String())
+		res := dl.Result
+		*res = downloadOutput{Package: dl.Package, Version: dl.Version.String(), Status: "error"}
+		if !structuredOutput() {
+			fmt.Printf("Downloading: %v (%v)\n", dl.Package, dl.Version.String())
+		}
 		url, err := pkgs.FetchPath(dl.Package, dl.Version)
 		if err != nil {
-			fmt.Printf("[%s] Error!: %v\n", dl.Package, err)
+			res.Error = err.Error()
+			if !structuredOutput() {
+				fmt.Printf("[%s] Error!: %v\n", dl.Package, err)
+			}
 			continue
 		}
 
-		outPath := path.Join(dl.OutPath, path.Base(url))
-		if err := downloadFile(tr, url, outPath, md5IfExists(outPath)); err != nil {
-			fmt.Printf("[%s] Error!: %v\n", dl.Package, err)
-			continue
+		res.URL = url
+		res.Path = path.Join(dl.OutPath, path.Base(url))
+		notModified, err := downloadFile(tr, url, res.Path, md5IfExists(res.Path))
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+			if !structuredOutput() {
+				fmt.Printf("[%s] Error!: %v\n", dl.Package, err)
+			}
+		case notModified:
+			res.Status = "not-modified"
+			if !structuredOutput() {
+				fmt.Printf("[304] %s is not modified, skipping\n", path.Base(res.Path))
+			}
+		default:
+			res.Status = "downloaded"
 		}
 	}
 }
 
-func downloadPriorityDeps(pkgs, installed *debdep.PackageInfo, priority, outPath string) error {
-	var packages []string
-	if priority == "essential" {
-		packages = pkgs.GetAllEssential()
-	} else {
-		packages = pkgs.GetAllByPriority(priority)
-	}
-
-	debOps, err := multitargetInstallGraph(pkgs, installed, packages)
-	if err != nil {
-		return err
-	}
-
+// downloadOps downloads the packages installed by the given operations to
+// outPath, writing the outcome of each download if --output is set.
+func downloadOps(pkgs *debdep.PackageInfo, debOps []debdep.Operation, outPath string) {
+	results := make([]downloadOutput, len(debOps))
 	workChan := make(chan downloadWork)
 	var wg sync.WaitGroup
 	for i := 0; i < 3; i++ {
 		wg.Add(1)
 		go downloadWorker(&wg, workChan, pkgs, tr)
 	}
-	for _, op := range debOps {
+	for i, op := range debOps {
 		workChan <- downloadWork{
 			OutPath: outPath,
 			Package: op.Package,
 			Version: op.Version,
+			Result:  &results[i],
 		}
 	}
 	close(workChan)
 	wg.Wait()
 
-	return nil
+	if structuredOutput() {
+		writeOutput(struct {
+			Downloads []downloadOutput `json:"downloads" yaml:"downloads"`
+		}{results})
+	}
 }
 
-func downloadSpecificDeps(pkgs, installed *debdep.PackageInfo, deps, outPath string) error {
-	debOps, err := multitargetInstallGraph(pkgs, installed, strings.Split(deps, " "))
+func downloadPriorityDeps(pkgs, installed *debdep.PackageInfo, priority, outPath string) error {
+	var packages []string
+	if priority == "essential" {
+		packages = pkgs.GetAllEssential()
+	} else {
+		packages = pkgs.GetAllByPriority(priority)
+	}
+
+	graph, err := pkgs.InstallGraphMulti(packages, installed, resolveOptions())
 	if err != nil {
 		return err
 	}
+	downloadOps(pkgs, graph.Unroll(), outPath)
+	return nil
+}
 
-	workChan := make(chan downloadWork)
-	var wg sync.WaitGroup
-	for i := 0; i < 3; i++ {
-		wg.Add(1)
-		go downloadWorker(&wg, workChan, pkgs, tr)
-	}
-	for _, op := range debOps {
-		workChan <- downloadWork{
-			OutPath: outPath,
-			Package: op.Package,
-			Version: op.Version,
-		}
+func downloadSpecificDeps(pkgs, installed *debdep.PackageInfo, deps, outPath string) error {
+	graph, err := pkgs.InstallGraphMulti(debdep.SplitTargetSpecs(deps), installed, resolveOptions())
+	if err != nil {
+		return err
 	}
-	close(workChan)
-	wg.Wait()
-
+	downloadOps(pkgs, graph.Unroll(), outPath)
 	return nil
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/twitchyliquid64/debdep"
+)
+
+func lockCmd(pkgs, installed *debdep.PackageInfo, targets []string) {
+	if len(targets) == 0 {
+		fmt.Fprintf(os.Stderr, "USAGE: %s lock <package-name>...\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	graph, err := pkgs.InstallGraphMulti(targets, installed, resolveOptions())
+	if err != nil {
+		fail("Error", err)
+	}
+	lock, err := pkgs.Lock(targets, graph)
+	if err != nil {
+		fail("Error", err)
+	}
+	if err := lock.Write(os.Stdout); err != nil {
+		fail("Error", err)
+	}
+}
+
+type syncWork struct {
+	URL     string
+	OutPath string
+	Package debdep.LockedPackage
+
+	// Result is where the outcome of the download is recorded.
+	Result *downloadOutput
+}
+
+// verifyFile returns an error if the file at outPath does not have the
+// locked hash.
+func verifyFile(pkg debdep.LockedPackage, outPath string) error {
+	f, err := os.Open(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return pkg.Verify(f)
+}
+
+func syncWorker(wg *sync.WaitGroup, work chan syncWork) {
+	defer wg.Done()
+	for dl := range work {
+		res := dl.Result
+		*res = downloadOutput{Package: dl.Package.Package, Version: dl.Package.Version, URL: dl.URL, Path: dl.OutPath, Status: "error"}
+		if verifyFile(dl.Package, dl.OutPath) == nil {
+			res.Status = "not-modified"
+			if !structuredOutput() {
+				fmt.Printf("[ok] %s is up to date, skipping\n", path.Base(dl.OutPath))
+			}
+			continue
+		}
+
+		if !structuredOutput() {
+			fmt.Printf("Downloading: %v (%v)\n", dl.Package.Package, dl.Package.Version)
+		}
+		_, err := downloadFile(tr, dl.URL, dl.OutPath, "")
+		if err == nil {
+			if err = verifyFile(dl.Package, dl.OutPath); err != nil {
+				os.Remove(dl.OutPath)
+			}
+		}
+		if err != nil {
+			res.Error = err.Error()
+			if !structuredOutput() {
+				fmt.Printf("[%s] Error!: %v\n", dl.Package.Package, err)
+			}
+			continue
+		}
+		res.Status = "downloaded"
+	}
+}
+
+func syncCmd(conf debdep.ResolverConfig, pkgs *debdep.PackageInfo, lockPath, outPath string) {
+	if lockPath == "" || outPath == "" {
+		fmt.Fprintf(os.Stderr, "USAGE: %s sync <lockfile> <directory>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	f, err := os.Open(lockPath)
+	if err != nil {
+		fail("Error reading lockfile", err)
+	}
+	lock, err := debdep.ReadLockfile(f)
+	f.Close()
+	if err != nil {
+		fail("Error reading lockfile", err)
+	}
+	if err := pkgs.CheckLock(lock); err != nil {
+		fail("Error", err)
+	}
+
+	results := make([]downloadOutput, len(lock.Packages))
+	workChan := make(chan syncWork)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go syncWorker(&wg, workChan)
+	}
+	for i, pkg := range lock.Packages {
+		workChan <- syncWork{
+			URL:     conf.BaseURL + "/" + pkg.Filename,
+			OutPath: path.Join(outPath, path.Base(pkg.Filename)),
+			Package: pkg,
+			Result:  &results[i],
+		}
+	}
+	close(workChan)
+	wg.Wait()
+
+	if structuredOutput() {
+		writeOutput(struct {
+			Downloads []downloadOutput `json:"downloads" yaml:"downloads"`
+		}{results})
+	}
+	for _, res := range results {
+		if res.Status == "error" {
+			os.Exit(1)
+		}
+	}
+}
@@ -2,10 +2,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/twitchyliquid64/debdep"
 )
@@ -14,16 +18,50 @@ var (
 	fetchBase         = flag.String("addr", "https://cdn-aws.deb.debian.org/debian", "Base repository URL")
 	codename          = flag.String("codename", "buster", "Debian codename")
 	arch              = flag.String("arch", "amd64", "Architecture")
+	foreignArches     = flag.String("foreign_arches", "", "Comma-separated list of foreign architectures packages may be installed for, such as i386")
 	pkgsFromFile      = flag.String("packages_file", "", "Path to read package info from instead of fetching from remote")
 	installedFromFile = flag.String("installed_file", "", "Path to read installed package info")
+	extendedStates    = flag.String("extended_states", "", "Path to read apt's extended package states, typically /var/lib/apt/extended_states")
+	releaseFromFile   = flag.String("release_file", "", "Path to the Release file describing the suite of --packages_file")
+	extraSuites       = flag.String("extra_suites", "", "Comma-separated list of additional suites to fetch packages from, such as buster-backports")
+	extraPkgsFiles    = flag.String("extra_packages_files", "", "Comma-separated list of additional package info files, each optionally followed by '=' and the path to its Release file")
+	preferences       = flag.String("preferences", "", "Path to an apt preferences file, used to pin package versions")
+	targetRelease     = flag.String("target_release", "", "Suite or codename to prefer packages from, as with apt's --target-release")
+	sourcesFromFile   = flag.String("sources_file", "", "Path to read source package info (a Sources index) from instead of fetching from remote")
+	hostArch          = flag.String("host_arch", "", "Architecture to resolve build dependencies for when cross-building")
+	buildProfiles     = flag.String("build_profiles", "", "Comma-separated list of active build profiles, such as nocheck")
+	archOnly          = flag.Bool("arch_only", false, "Only resolve the build dependencies of architecture-dependent packages")
+	indepOnly         = flag.Bool("indep_only", false, "Only resolve the build dependencies of architecture-independent packages")
+	essential         = flag.Bool("essential", false, "Treat Essential packages as implicitly required, installing them ahead of the requested packages")
+	excludePkgs       = flag.String("exclude", "", "Comma-separated list of packages which must never be installed, or @path to read them from a file")
+	holdPkgs          = flag.String("hold", "", "Comma-separated list of packages to keep at their installed version, or @path to read them from a file")
+	providedPkgs      = flag.String("provided", "", "Comma-separated list of packages provided externally, whose dependencies are treated as satisfied, or @path to read them from a file")
+	maxDepth          = flag.Int("max_depth", 0, "Maximum length of dependency chains to follow when resolving, or 0 for no limit")
+	maxNodes          = flag.Int("max_nodes", 0, "Maximum number of relations to evaluate when resolving, or 0 for no limit")
+	timeout           = flag.Duration("timeout", 0, "Maximum time to spend resolving dependencies, such as 30s, or 0 for no limit")
+	batches           = flag.Bool("batches", false, "Group the output of bootstrap-sequence into batches of packages which can be installed concurrently")
+	phases            = flag.Bool("phases", false, "Show the unpack and configure steps of bootstrap-sequence separately, as performed by dpkg")
+	oldPkgsFile       = flag.String("old_packages", "", "Path to the package info file to compare against, for diff-graph")
+	newPkgsFile       = flag.String("new_packages", "", "Path to the updated package info file, for diff-graph")
+	showSizes         = flag.Bool("sizes", false, "Show the installed and download size of each package in the output of bootstrap-sequence")
+	workers           = flag.Int("workers", 0, "Number of packages check-installability resolves concurrently, or 0 for one per CPU")
+	graphFormat       = flag.String("format", "dot", "Format of the graph written by the graph command: dot, graphml or json")
 )
 
 func main() {
 	flag.Parse()
+	checkOutputFormat()
 	conf := debdep.DefaultResolverConfig
 	conf.BaseURL = *fetchBase
 	conf.Codename = *codename
 	conf.Arch.Arch = *arch
+	if *foreignArches != "" {
+		conf.ForeignArches = strings.Split(*foreignArches, ",")
+	}
+	if *hostArch != "" && *hostArch != conf.Arch.Arch {
+		// Build dependencies are satisfied by packages of the host architecture.
+		conf.ForeignArches = append(conf.ForeignArches, *hostArch)
+	}
 
 	var packages *debdep.PackageInfo
 	var err error
@@ -31,19 +69,29 @@ func main() {
 	if *installedFromFile != "" {
 		installed, err = debdep.LoadPackageInfo(conf, *installedFromFile, true)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading installed packages: %v\n", err)
-			os.Exit(1)
+			fail("Error reading installed packages", err)
 		}
 	}
 
-	if *pkgsFromFile == "" {
-		packages, err = debdep.Packages(conf, true)
-	} else {
-		packages, err = debdep.LoadPackageInfo(conf, *pkgsFromFile, true)
+	// These commands operate on the installed packages alone, so do
+	// not need package info from the repository.
+	switch flag.Arg(0) {
+	case "remove-impact":
+		removeImpactCmd(installed, flag.Arg(1))
+		return
+	case "autoremove":
+		autoremoveCmd(installed)
+		return
+	case "check":
+		checkCmd(installed)
+		return
+	case "diff-graph":
+		diffGraphCmd(conf, installed, flag.Args()[1:])
+		return
 	}
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading packages: %v\n", err)
-		os.Exit(1)
+
+	if packages, err = loadPackages(conf); err != nil {
+		fail("Error reading packages", err)
 	}
 	fmt.Fprintf(os.Stderr, "Read %d packages.\n", len(packages.Packages))
 
@@ -51,12 +99,39 @@ func main() {
 	case "all-priority":
 		allPriorityCmd(packages, flag.Arg(1))
 
+	case "query":
+		queryCmd(packages, flag.Arg(1))
+
 	case "calculate-deps":
 		calculateDepsCommand(packages, installed, flag.Arg(1))
 
 	case "bootstrap-sequence":
 		bootstrapSequenceCmd(packages, installed, flag.Arg(1))
 
+	case "graph":
+		graphCmd(packages, installed, flag.Arg(1))
+
+	case "size":
+		sizeCmd(packages, installed, flag.Args()[1:])
+
+	case "check-installability":
+		checkInstallabilityCmd(packages, installed)
+
+	case "lock":
+		lockCmd(packages, installed, flag.Args()[1:])
+
+	case "sync":
+		syncCmd(conf, packages, flag.Arg(1), flag.Arg(2))
+
+	case "why":
+		whyCmd(packages, installed, flag.Arg(1), flag.Arg(2))
+
+	case "upgrade-plan":
+		upgradePlanCmd(packages, installed)
+
+	case "build-deps":
+		buildDepsCmd(conf, packages, installed, flag.Arg(1))
+
 	case "check-dist":
 		checkDistCmd(conf)
 
@@ -64,18 +139,186 @@ func main() {
 		downloadPackageInfo(conf, flag.Arg(1))
 
 	case "download-priority-deps":
-		downloadPriorityDeps(packages, installed, flag.Arg(1), flag.Arg(2))
+		if err := downloadPriorityDeps(packages, installed, flag.Arg(1), flag.Arg(2)); err != nil {
+			fail("Error", err)
+		}
 
 	case "download-specific-deps":
-		downloadSpecificDeps(packages, installed, flag.Arg(1), flag.Arg(2))
+		if err := downloadSpecificDeps(packages, installed, flag.Arg(1), flag.Arg(2)); err != nil {
+			fail("Error", err)
+		}
 
 	default:
 		fmt.Printf("Unknown command: %q\n", flag.Arg(0))
-		fmt.Println("Available commands: all-priority, calculate-deps, bootstrap-sequence, check-dist, download-pkg-info, download-priority-deps, download-specific-deps")
+		fmt.Println("Available commands: all-priority, query, calculate-deps, bootstrap-sequence, graph, diff-graph, check-installability, size, lock, sync, why, upgrade-plan, build-deps, remove-impact, autoremove, check, check-dist, download-pkg-info, download-priority-deps, download-specific-deps")
 		os.Exit(1)
 	}
 }
 
+// usePolicy returns true if flags were provided which affect the selection
+// of candidate versions.
+func usePolicy() bool {
+	return *preferences != "" || *targetRelease != ""
+}
+
+// resolveOptions returns the options for dependency resolution set by flags.
+func resolveOptions() debdep.ResolveOptions {
+	opts := debdep.ResolveOptions{
+		Essential: *essential,
+		MaxDepth:  *maxDepth,
+		MaxNodes:  *maxNodes,
+		Timeout:   *timeout,
+	}
+	var err error
+	if opts.Exclude, err = readPackageList(*excludePkgs); err != nil {
+		fail("Error reading --exclude", err)
+	}
+	if opts.Hold, err = readPackageList(*holdPkgs); err != nil {
+		fail("Error reading --hold", err)
+	}
+	if opts.Provided, err = readPackageList(*providedPkgs); err != nil {
+		fail("Error reading --provided", err)
+	}
+	return opts
+}
+
+// readPackageList parses a comma-separated list of package names. Entries
+// of the form @path are replaced by the names listed in the file, one per
+// line. Only the first field of each line is used, so the output of
+// apt-mark showhold or dpkg --get-selections can be read, and lines
+// starting with # are ignored.
+func readPackageList(spec string) ([]string, error) {
+	var out []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if !strings.HasPrefix(entry, "@") {
+			if entry != "" {
+				out = append(out, entry)
+			}
+			continue
+		}
+
+		b, err := ioutil.ReadFile(entry[1:])
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+				out = append(out, fields[0])
+			}
+		}
+	}
+	return out, nil
+}
+
+// installGraph computes the install graph for a single target.
+func installGraph(pkgs, installed *debdep.PackageInfo, target string) (*debdep.Operation, error) {
+	return pkgs.InstallGraphContext(context.Background(), target, installed, resolveOptions())
+}
+
+// loadPackages reads the package info from the repository (or the package
+// info file), and from any additional suites.
+func loadPackages(conf debdep.ResolverConfig) (*debdep.PackageInfo, error) {
+	var packages *debdep.PackageInfo
+	var err error
+	if *pkgsFromFile == "" {
+		if packages, err = debdep.Packages(conf, true); err != nil {
+			return nil, err
+		}
+		if usePolicy() {
+			if packages.Release, err = debdep.FetchRelease(conf); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if packages, err = debdep.LoadPackageInfo(conf, *pkgsFromFile, true); err != nil {
+			return nil, err
+		}
+		if *releaseFromFile != "" {
+			if packages.Release, err = debdep.LoadRelease(conf, *releaseFromFile); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if *extraSuites != "" {
+		for _, suite := range strings.Split(*extraSuites, ",") {
+			c := conf
+			c.Codename = suite
+			extra, err := debdep.Packages(c, true)
+			if err != nil {
+				return nil, fmt.Errorf("suite %q: %v", suite, err)
+			}
+			if extra.Release, err = debdep.FetchRelease(c); err != nil {
+				return nil, fmt.Errorf("suite %q: %v", suite, err)
+			}
+			if err := packages.Merge(extra); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if *extraPkgsFiles != "" {
+		for _, spec := range strings.Split(*extraPkgsFiles, ",") {
+			spl := strings.SplitN(spec, "=", 2)
+			extra, err := debdep.LoadPackageInfo(conf, spl[0], true)
+			if err != nil {
+				return nil, err
+			}
+			if len(spl) == 2 {
+				if extra.Release, err = debdep.LoadRelease(conf, spl[1]); err != nil {
+					return nil, err
+				}
+			}
+			if err := packages.Merge(extra); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if *pkgsFromFile != "" {
+		// Foreign packages are only fetched from the repository, so must
+		// be given in a file of their own when reading from files.
+		for _, arch := range conf.ForeignArches {
+			if !hasArch(packages, arch) {
+				return nil, fmt.Errorf("no packages of foreign architecture %q were read, give its packages file with --extra_packages_files", arch)
+			}
+		}
+	}
+
+	if usePolicy() {
+		packages.Policy = &debdep.Policy{TargetRelease: *targetRelease}
+		if *preferences != "" {
+			if packages.Policy.Pins, err = debdep.LoadPreferences(*preferences); err != nil {
+				return nil, fmt.Errorf("reading preferences: %v", err)
+			}
+		}
+	}
+	return packages, nil
+}
+
+// hasArch returns true if pkgs includes any package of the given
+// architecture.
+func hasArch(pkgs *debdep.PackageInfo, arch string) bool {
+	for _, versions := range pkgs.Packages {
+		for _, pkg := range versions {
+			if pkg.Arch() == arch {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printResolveError writes err to stderr, followed by a detailed explanation
+// if it describes an unsatisfiable dependency.
+func printResolveError(prefix string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", prefix, err)
+	var depErr debdep.ErrDependency
+	if errors.As(err, &depErr) {
+		depErr.Explain(os.Stderr)
+	}
+}
+
 func downloadPackageInfo(conf debdep.ResolverConfig, path string) {
 	if flag.NArg() < 2 {
 		fmt.Fprintf(os.Stderr, "USAGE: %s download-pkg-info <output-path>\n", os.Args[0])
@@ -84,34 +327,42 @@ func downloadPackageInfo(conf debdep.ResolverConfig, path string) {
 
 	r, err := debdep.RepositoryPackagesReader(conf, true)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		fail("Error", err)
 	}
 	defer r.Close()
 
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0655)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		fail("Error", err)
 	}
 	defer f.Close()
 
 	if _, err := io.Copy(f, r); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		fail("Error", err)
+	}
+	if structuredOutput() {
+		writeOutput(struct {
+			Path string `json:"path" yaml:"path"`
+		}{path})
 	}
 }
 
 func calculateDepsCommand(pkgs, installed *debdep.PackageInfo, pkgName string) {
 	if flag.NArg() < 2 {
-		fmt.Fprintf(os.Stderr, "USAGE: %s calculate-deps <package-name>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "USAGE: %s calculate-deps <target>\n", os.Args[0])
 		os.Exit(1)
 	}
 
-	pkg, err := pkgs.InstallGraph(pkgName, installed)
+	pkg, err := installGraph(pkgs, installed, pkgName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating install graph: %v\n", err)
-		os.Exit(1)
+		fail("Error generating install graph", err)
+	}
+	if structuredOutput() {
+		writeOutput(struct {
+			Target string          `json:"target" yaml:"target"`
+			Graph  operationOutput `json:"graph" yaml:"graph"`
+		}{pkgName, newOperationOutput(pkg)})
+		return
 	}
 	pkg.PrettyWrite(os.Stdout, 1)
 }
@@ -128,48 +379,657 @@ func allPriorityCmd(pkgs *debdep.PackageInfo, priority string) {
 	} else {
 		packages = pkgs.GetAllByPriority(priority)
 	}
+	if structuredOutput() {
+		writeOutput(struct {
+			Priority string   `json:"priority" yaml:"priority"`
+			Packages []string `json:"packages" yaml:"packages"`
+		}{priority, append([]string{}, packages...)})
+		return
+	}
 	for i, p := range packages {
 		fmt.Printf("%.03d %s\n", i, p)
 	}
 }
 
-func bootstrapSequenceCmd(pkgs, installed *debdep.PackageInfo, pkgName string) {
+func queryCmd(pkgs *debdep.PackageInfo, expr string) {
 	if flag.NArg() < 2 {
-		fmt.Fprintf(os.Stderr, "USAGE: %s bootstrap-sequence <package-name>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "USAGE: %s query <expression>\n", os.Args[0])
 		os.Exit(1)
 	}
 
-	pkg, err := pkgs.InstallGraph(pkgName, installed)
+	q, err := debdep.ParseQuery(expr)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fail("Error", err)
+	}
+	packages := pkgs.GetAllMatching(q)
+	if structuredOutput() {
+		writeOutput(struct {
+			Query    string   `json:"query" yaml:"query"`
+			Packages []string `json:"packages" yaml:"packages"`
+		}{expr, append([]string{}, packages...)})
+		return
+	}
+	// Names are written alone, so the output can be passed to
+	// download-specific-deps.
+	for _, p := range packages {
+		fmt.Println(p)
+	}
+}
+
+func bootstrapSequenceCmd(pkgs, installed *debdep.PackageInfo, pkgName string) {
+	if flag.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "USAGE: %s bootstrap-sequence <target>\n", os.Args[0])
 		os.Exit(1)
 	}
-	for i, op := range pkg.Unroll() {
+	if *batches && *phases {
+		fmt.Fprintf(os.Stderr, "USAGE: %s bootstrap-sequence accepts only one of --batches and --phases\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	pkg, err := installGraph(pkgs, installed, pkgName)
+	if err != nil {
+		fail("Error", err)
+	}
+
+	var steps []stepOutput
+	switch {
+	case *batches:
+		levels, err := pkgs.InstallBatches(pkg)
+		if err != nil {
+			fail("Error", err)
+		}
+		for i, batch := range levels {
+			for _, op := range batch {
+				batch := i
+				steps = append(steps, stepOutput{Batch: &batch, Package: op.Package, Version: op.Version.String(), Arch: op.Arch, PreDep: op.PreDep})
+			}
+		}
+	case *phases:
+		ops, err := pkgs.InstallPhases(pkg)
+		if err != nil {
+			fail("Error", err)
+		}
+		for _, op := range ops {
+			action := "unpack"
+			if op.Kind == debdep.DebPackageConfigureOp {
+				action = "configure"
+			}
+			steps = append(steps, stepOutput{Action: action, Package: op.Package, Version: op.Version.String(), Arch: op.Arch, PreDep: op.PreDep})
+		}
+	default:
+		for _, op := range pkg.Unroll() {
+			steps = append(steps, stepOutput{Package: op.Package, Version: op.Version.String(), Arch: op.Arch, PreDep: op.PreDep})
+		}
+	}
+	for i := range steps {
+		steps[i].Index = i
+	}
+	// Sizes are only computed when shown, as they are not needed to order
+	// the packages.
+	size := &debdep.InstallSize{}
+	if *showSizes || structuredOutput() {
+		if size, err = pkgs.GraphSize(pkg); err != nil {
+			fail("Error", err)
+		}
+		pkgSizes := map[string]debdep.PackageSize{}
+		for _, s := range size.Packages {
+			pkgSizes[s.Package] = s
+		}
+		for i := range steps {
+			steps[i].InstalledSize = pkgSizes[steps[i].Package].InstalledSize
+			steps[i].DownloadSize = pkgSizes[steps[i].Package].DownloadSize
+		}
+	}
+
+	if structuredOutput() {
+		writeOutput(struct {
+			Target        string       `json:"target" yaml:"target"`
+			Steps         []stepOutput `json:"steps" yaml:"steps"`
+			InstalledSize int64        `json:"installed_size" yaml:"installed_size"`
+			DownloadSize  int64        `json:"download_size" yaml:"download_size"`
+		}{pkgName, steps, size.InstalledSize, size.DownloadSize})
+		return
+	}
+	for _, step := range steps {
 		marker := "[ ]"
-		if op.PreDep {
+		if step.PreDep {
 			marker = "[*]"
 		}
-		fmt.Printf("%.03d %s %s %s\n", i, marker, op.Package, op.Version.String())
+		var line string
+		switch {
+		case step.Batch != nil:
+			line = fmt.Sprintf("%.03d %.03d %s %s %s", step.Index, *step.Batch, marker, step.Package, step.Version)
+		case step.Action != "":
+			line = fmt.Sprintf("%.03d %-9s %s %s", step.Index, step.Action, step.Package, step.Version)
+		default:
+			line = fmt.Sprintf("%.03d %s %s %s", step.Index, marker, step.Package, step.Version)
+		}
+		if *showSizes {
+			line += fmt.Sprintf(" (%s installed, %s download)", formatSize(step.InstalledSize), formatSize(step.DownloadSize))
+		}
+		fmt.Println(line)
+	}
+	if *showSizes {
+		fmt.Printf("Total: %s installed, %s download\n", formatSize(size.InstalledSize), formatSize(size.DownloadSize))
 	}
 }
 
-func checkDistCmd(conf debdep.ResolverConfig) {
-	err := debdep.CheckReleaseStatus(conf)
+func buildDepsCmd(conf debdep.ResolverConfig, pkgs, installed *debdep.PackageInfo, srcName string) {
+	if flag.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "USAGE: %s build-deps <source-package>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	var sources *debdep.PackageInfo
+	var err error
+	if *sourcesFromFile != "" {
+		sources, err = debdep.LoadPackageInfo(conf, *sourcesFromFile, false)
+	} else {
+		sources, err = debdep.Packages(conf, false)
+	}
+	if err != nil {
+		fail("Error reading source packages", err)
+	}
+	src, err := sources.FindCandidate(srcName)
+	if err != nil {
+		fail("Error", fmt.Errorf("source package %q: %w", srcName, err))
+	}
+
+	opts := debdep.BuildOptions{
+		HostArch:       *hostArch,
+		ArchOnly:       *archOnly,
+		IndepOnly:      *indepOnly,
+		ResolveOptions: resolveOptions(),
+	}
+	if *buildProfiles != "" {
+		opts.Profiles = strings.Split(*buildProfiles, ",")
+	}
+	graph, err := pkgs.BuildDepsGraph(src, installed, opts)
+	if err != nil {
+		fail("Error", err)
+	}
+	if structuredOutput() {
+		out := struct {
+			Source   string       `json:"source" yaml:"source"`
+			Version  string       `json:"version" yaml:"version"`
+			Packages []packageRef `json:"packages" yaml:"packages"`
+		}{Source: srcName, Version: src.Values["Version"], Packages: []packageRef{}}
+		for _, op := range graph.Unroll() {
+			out.Packages = append(out.Packages, packageRef{op.Package, op.Version.String()})
+		}
+		writeOutput(out)
+		return
+	}
+	for i, op := range graph.Unroll() {
+		fmt.Printf("%.03d %s %s\n", i, op.Package, op.Version.String())
+	}
+}
+
+func graphCmd(pkgs, installed *debdep.PackageInfo, pkgName string) {
+	if flag.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "USAGE: %s [--format=dot|graphml|json] graph <target>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	var write func(*debdep.Graph, io.Writer) error
+	switch *graphFormat {
+	case "dot":
+		write = (*debdep.Graph).WriteDOT
+	case "graphml":
+		write = (*debdep.Graph).WriteGraphML
+	case "json":
+		write = (*debdep.Graph).WriteJSON
+	default:
+		fail("Error", fmt.Errorf("unknown graph format %q, want dot, graphml or json", *graphFormat))
+	}
+
+	pkg, err := installGraph(pkgs, installed, pkgName)
+	if err != nil {
+		fail("Error", err)
+	}
+	graph, err := pkgs.ExportGraph(pkg)
+	if err != nil {
+		fail("Error", err)
+	}
+	if structuredOutput() {
+		writeOutput(struct {
+			Target string        `json:"target" yaml:"target"`
+			Graph  *debdep.Graph `json:"graph" yaml:"graph"`
+		}{pkgName, graph})
+		return
+	}
+	if err := write(graph, os.Stdout); err != nil {
+		fail("Error", err)
+	}
+}
+
+// formatSize returns a human-friendly representation of a size, given in
+// bytes.
+func formatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KiB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// formatSizeDelta returns a human-friendly representation of a change in
+// size, given in bytes.
+func formatSizeDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + formatSize(-delta)
+	}
+	return "+" + formatSize(delta)
+}
+
+// sizeOutput describes the space used by a package.
+type sizeOutput struct {
+	Package       string `json:"package" yaml:"package"`
+	Version       string `json:"version" yaml:"version"`
+	InstalledSize int64  `json:"installed_size" yaml:"installed_size"`
+	DownloadSize  int64  `json:"download_size" yaml:"download_size"`
+}
+
+// exclusiveOutput describes the packages only needed by one target.
+type exclusiveOutput struct {
+	Target        string   `json:"target" yaml:"target"`
+	Packages      []string `json:"packages" yaml:"packages"`
+	InstalledSize int64    `json:"installed_size" yaml:"installed_size"`
+	DownloadSize  int64    `json:"download_size" yaml:"download_size"`
+}
+
+func sizeCmd(pkgs, installed *debdep.PackageInfo, targets []string) {
+	if len(targets) == 0 {
+		fmt.Fprintf(os.Stderr, "USAGE: %s size <package-name>...\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	opts := resolveOptions()
+	graph, err := pkgs.InstallGraphMulti(targets, installed, opts)
+	if err != nil {
+		fail("Error", err)
+	}
+	size, err := pkgs.GraphSize(graph)
+	if err != nil {
+		fail("Error", err)
+	}
+	exclusive, err := pkgs.ExclusiveSizes(graph, targets, installed, opts)
+	if err != nil {
+		fail("Error", err)
+	}
+
+	if structuredOutput() {
+		out := struct {
+			Targets       []string          `json:"targets" yaml:"targets"`
+			Packages      []sizeOutput      `json:"packages" yaml:"packages"`
+			InstalledSize int64             `json:"installed_size" yaml:"installed_size"`
+			DownloadSize  int64             `json:"download_size" yaml:"download_size"`
+			Exclusive     []exclusiveOutput `json:"exclusive" yaml:"exclusive"`
+		}{Targets: targets, Packages: []sizeOutput{}, InstalledSize: size.InstalledSize, DownloadSize: size.DownloadSize}
+		for _, s := range size.Packages {
+			out.Packages = append(out.Packages, sizeOutput{s.Package, s.Version.String(), s.InstalledSize, s.DownloadSize})
+		}
+		for _, e := range exclusive {
+			out.Exclusive = append(out.Exclusive, exclusiveOutput{e.Target, append([]string{}, e.Packages...), e.InstalledSize, e.DownloadSize})
+		}
+		writeOutput(out)
+		return
+	}
+
+	fmt.Printf("Packages (%d):\n", len(size.Packages))
+	for _, s := range size.Packages {
+		fmt.Printf("  %s %s (%s installed, %s download)\n", s.Package, s.Version.String(), formatSize(s.InstalledSize), formatSize(s.DownloadSize))
+	}
+	fmt.Printf("Total: %s installed, %s download\n", formatSize(size.InstalledSize), formatSize(size.DownloadSize))
+	fmt.Println("Exclusive to each target:")
+	for _, e := range exclusive {
+		fmt.Printf("  %s: %d package(s), %s installed, %s download\n", e.Target, len(e.Packages), formatSize(e.InstalledSize), formatSize(e.DownloadSize))
+	}
+}
+
+// changeOutput describes a package which differs between two install graphs.
+type changeOutput struct {
+	Package            string `json:"package" yaml:"package"`
+	OldVersion         string `json:"old_version,omitempty" yaml:"old_version,omitempty"`
+	NewVersion         string `json:"new_version,omitempty" yaml:"new_version,omitempty"`
+	InstalledSizeDelta int64  `json:"installed_size_delta" yaml:"installed_size_delta"`
+	DownloadSizeDelta  int64  `json:"download_size_delta" yaml:"download_size_delta"`
+}
+
+func newChangeOutputs(changes []debdep.PackageChange, hasOld, hasNew bool) []changeOutput {
+	out := []changeOutput{}
+	for _, c := range changes {
+		o := changeOutput{
+			Package:            c.Package,
+			InstalledSizeDelta: c.InstalledSizeDelta,
+			DownloadSizeDelta:  c.DownloadSizeDelta,
+		}
+		if hasOld {
+			o.OldVersion = c.OldVersion.String()
+		}
+		if hasNew {
+			o.NewVersion = c.NewVersion.String()
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+func diffGraphCmd(conf debdep.ResolverConfig, installed *debdep.PackageInfo, targets []string) {
+	if *oldPkgsFile == "" || *newPkgsFile == "" || len(targets) == 0 {
+		fmt.Fprintf(os.Stderr, "USAGE: %s --old_packages <packages-file> --new_packages <packages-file> diff-graph <target>...\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	oldPkgs, err := debdep.LoadPackageInfo(conf, *oldPkgsFile, true)
+	if err != nil {
+		fail("Error reading old packages", err)
+	}
+	newPkgs, err := debdep.LoadPackageInfo(conf, *newPkgsFile, true)
+	if err != nil {
+		fail("Error reading new packages", err)
+	}
+	diff, err := debdep.DiffInstallGraphs(oldPkgs, newPkgs, targets, installed, resolveOptions())
+	if err != nil {
+		fail("Error", err)
+	}
+
+	if structuredOutput() {
+		writeOutput(struct {
+			Targets            []string       `json:"targets" yaml:"targets"`
+			Added              []changeOutput `json:"added" yaml:"added"`
+			Removed            []changeOutput `json:"removed" yaml:"removed"`
+			Upgraded           []changeOutput `json:"upgraded" yaml:"upgraded"`
+			Downgraded         []changeOutput `json:"downgraded" yaml:"downgraded"`
+			InstalledSizeDelta int64          `json:"installed_size_delta" yaml:"installed_size_delta"`
+			DownloadSizeDelta  int64          `json:"download_size_delta" yaml:"download_size_delta"`
+		}{
+			Targets:            targets,
+			Added:              newChangeOutputs(diff.Added, false, true),
+			Removed:            newChangeOutputs(diff.Removed, true, false),
+			Upgraded:           newChangeOutputs(diff.Upgraded, true, true),
+			Downgraded:         newChangeOutputs(diff.Downgraded, true, true),
+			InstalledSizeDelta: diff.InstalledSizeDelta,
+			DownloadSizeDelta:  diff.DownloadSizeDelta,
+		})
+		return
+	}
+
+	fmt.Printf("Added (%d):\n", len(diff.Added))
+	for _, c := range diff.Added {
+		fmt.Printf("  %s %s (%s)\n", c.Package, c.NewVersion.String(), formatSizeDelta(c.InstalledSizeDelta))
+	}
+	fmt.Printf("Removed (%d):\n", len(diff.Removed))
+	for _, c := range diff.Removed {
+		fmt.Printf("  %s %s (%s)\n", c.Package, c.OldVersion.String(), formatSizeDelta(c.InstalledSizeDelta))
+	}
+	fmt.Printf("Upgraded (%d):\n", len(diff.Upgraded))
+	for _, c := range diff.Upgraded {
+		fmt.Printf("  %s %s -> %s (%s)\n", c.Package, c.OldVersion.String(), c.NewVersion.String(), formatSizeDelta(c.InstalledSizeDelta))
+	}
+	fmt.Printf("Downgraded (%d):\n", len(diff.Downgraded))
+	for _, c := range diff.Downgraded {
+		fmt.Printf("  %s %s -> %s (%s)\n", c.Package, c.OldVersion.String(), c.NewVersion.String(), formatSizeDelta(c.InstalledSizeDelta))
+	}
+	fmt.Printf("Installed size: %s\n", formatSizeDelta(diff.InstalledSizeDelta))
+	fmt.Printf("Download size: %s\n", formatSizeDelta(diff.DownloadSizeDelta))
+}
+
+func checkInstallabilityCmd(pkgs, installed *debdep.PackageInfo) {
+	uninstallable, err := pkgs.CheckInstallability(installed, debdep.InstallabilityOptions{
+		Workers:        *workers,
+		ResolveOptions: resolveOptions(),
+	})
 	if err != nil {
-		if relData, ok := err.(debdep.ReleaseInconsistency); ok {
-			fmt.Printf("Configured debian state is inconsistent with the repositories!\n")
-			if relData.WantDistro != "" {
-				fmt.Printf("\tDistribution = %q (our setting: %q)\n", relData.GotDistro, relData.WantDistro)
+		fail("Error", err)
+	}
+
+	if structuredOutput() {
+		type uninstallableOutput struct {
+			Package string      `json:"package" yaml:"package"`
+			Version string      `json:"version" yaml:"version"`
+			Error   errorDetail `json:"error" yaml:"error"`
+		}
+		out := []uninstallableOutput{}
+		for _, u := range uninstallable {
+			out = append(out, uninstallableOutput{u.Package, u.Version.String(), newErrorDetail(u.Err)})
+		}
+		writeOutput(struct {
+			Uninstallable []uninstallableOutput `json:"uninstallable" yaml:"uninstallable"`
+		}{out})
+	} else {
+		for _, u := range uninstallable {
+			fmt.Printf("%s %s: %v\n", u.Package, u.Version.String(), u.Err)
+			var depErr debdep.ErrDependency
+			if errors.As(u.Err, &depErr) {
+				depErr.Explain(os.Stdout)
 			}
-			if relData.WantArch != "" {
-				fmt.Printf("\tArch = %q (our setting: %q)\n", relData.GotArch, relData.WantArch)
+		}
+		fmt.Printf("%d uninstallable package(s).\n", len(uninstallable))
+	}
+	if len(uninstallable) > 0 {
+		os.Exit(2)
+	}
+}
+
+func whyCmd(pkgs, installed *debdep.PackageInfo, target, pkgName string) {
+	if flag.NArg() < 3 {
+		fmt.Fprintf(os.Stderr, "USAGE: %s why <target> <package-name>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	chains, err := pkgs.Why(target, pkgName, installed)
+	if err != nil {
+		fail("Error", err)
+	}
+	if structuredOutput() {
+		out := struct {
+			Target  string         `json:"target" yaml:"target"`
+			Package string         `json:"package" yaml:"package"`
+			Chains  [][]linkOutput `json:"chains" yaml:"chains"`
+		}{Target: target, Package: pkgName, Chains: [][]linkOutput{}}
+		for _, chain := range chains {
+			out.Chains = append(out.Chains, newLinkOutputs(chain))
+		}
+		writeOutput(out)
+		return
+	}
+	for i, chain := range chains {
+		if i > 0 {
+			fmt.Println()
+		}
+		for j, link := range chain {
+			indent := ""
+			if j > 0 {
+				indent = " -> "
 			}
-			if relData.WantComponent != "" {
-				fmt.Printf("\tComponent = %q (our setting: %q)\n", relData.GotComponent, relData.WantComponent)
+			fmt.Printf("%s%s\n", indent, link.String())
+		}
+	}
+}
+
+func upgradePlanCmd(pkgs, installed *debdep.PackageInfo) {
+	if *installedFromFile == "" {
+		fmt.Fprintf(os.Stderr, "USAGE: %s --installed_file <status-file> upgrade-plan\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	plan, err := pkgs.PlanUpgrade(installed, resolveOptions())
+	if err != nil {
+		fail("Error", err)
+	}
+	if structuredOutput() {
+		writeOutput(newUpgradePlanOutput(plan))
+		return
+	}
+
+	fmt.Printf("Upgrades (%d):\n", len(plan.Upgrades))
+	for _, u := range plan.Upgrades {
+		fmt.Printf("  %s %s -> %s\n", u.Package, u.From.String(), u.To.String())
+	}
+	fmt.Printf("New (%d):\n", len(plan.New))
+	for _, op := range plan.New {
+		fmt.Printf("  %s %s\n", op.Package, op.Version.String())
+	}
+	fmt.Printf("Removals (%d):\n", len(plan.Removals))
+	for _, r := range plan.Removals {
+		fmt.Printf("  %s %s (%s)\n", r.Package, r.Version.String(), r.Reason)
+	}
+	fmt.Printf("Kept back (%d):\n", len(plan.KeptBack))
+	for _, k := range plan.KeptBack {
+		fmt.Printf("  %v\n", k)
+	}
+
+	fmt.Println("Operations:")
+	for i, op := range plan.Operations {
+		action := "install"
+		if op.Kind == debdep.DebPackageRemoveOp {
+			action = "remove "
+		}
+		fmt.Printf("%.03d %s %s %s\n", i, action, op.Package, op.Version.String())
+	}
+}
+
+func removeImpactCmd(installed *debdep.PackageInfo, pkgName string) {
+	if flag.NArg() < 2 || *installedFromFile == "" {
+		fmt.Fprintf(os.Stderr, "USAGE: %s --installed_file <status-file> remove-impact <package-name>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	removals, err := installed.RemovalImpact(pkgName)
+	if err != nil {
+		fail("Error", err)
+	}
+	if structuredOutput() {
+		writeOutput(struct {
+			Package  string          `json:"package" yaml:"package"`
+			Removals []removalOutput `json:"removals" yaml:"removals"`
+		}{pkgName, newRemovalOutputs(removals)})
+		return
+	}
+	for i, r := range removals {
+		fmt.Printf("%.03d %s %s (%s)\n", i, r.Package, r.Version.String(), r.Reason)
+	}
+}
+
+func checkCmd(installed *debdep.PackageInfo) {
+	if *installedFromFile == "" {
+		fmt.Fprintf(os.Stderr, "USAGE: %s --installed_file <status-file> check\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	broken, err := installed.CheckConsistency()
+	if err != nil {
+		fail("Error", err)
+	}
+
+	if structuredOutput() {
+		type relationOutput struct {
+			Field        string   `json:"field" yaml:"field"`
+			Relation     string   `json:"relation" yaml:"relation"`
+			Packages     []string `json:"packages,omitempty" yaml:"packages,omitempty"`
+			Installed    []string `json:"installed_versions,omitempty" yaml:"installed_versions,omitempty"`
+			Unconfigured []string `json:"unconfigured,omitempty" yaml:"unconfigured,omitempty"`
+		}
+		type brokenOutput struct {
+			Package   string           `json:"package" yaml:"package"`
+			Version   string           `json:"version" yaml:"version"`
+			State     string           `json:"state,omitempty" yaml:"state,omitempty"`
+			Relations []relationOutput `json:"relations,omitempty" yaml:"relations,omitempty"`
+		}
+		out := []brokenOutput{}
+		for _, b := range broken {
+			o := brokenOutput{Package: b.Package, Version: b.Version.String(), State: b.State}
+			for _, r := range b.Relations {
+				o.Relations = append(o.Relations, relationOutput{r.Field, r.Relation.String(), r.Packages, r.Installed, r.Unconfigured})
+			}
+			out = append(out, o)
+		}
+		writeOutput(struct {
+			Broken []brokenOutput `json:"broken" yaml:"broken"`
+		}{out})
+	} else {
+		for _, b := range broken {
+			fmt.Printf("%s %s:\n", b.Package, b.Version.String())
+			if b.State != "" {
+				fmt.Printf("  is %s, and not fully installed\n", b.State)
+			}
+			for _, r := range b.Relations {
+				fmt.Printf("  %s\n", r.String())
 			}
-		} else {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+		}
+		fmt.Printf("%d broken package(s).\n", len(broken))
+	}
+	if len(broken) > 0 {
+		os.Exit(2)
+	}
+}
+
+func autoremoveCmd(installed *debdep.PackageInfo) {
+	if *installedFromFile == "" || *extendedStates == "" {
+		fmt.Fprintf(os.Stderr, "USAGE: %s --installed_file <status-file> --extended_states <extended-states-file> autoremove\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	auto, err := debdep.LoadExtendedStates(*extendedStates, installed.Config.Arch.Arch)
+	if err != nil {
+		fail("Error reading extended states", err)
+	}
+	removals, err := installed.Autoremovable(auto)
+	if err != nil {
+		fail("Error", err)
+	}
+	if structuredOutput() {
+		writeOutput(struct {
+			Removals []removalOutput `json:"removals" yaml:"removals"`
+		}{newRemovalOutputs(removals)})
+		return
+	}
+	for i, r := range removals {
+		fmt.Printf("%.03d %s %s\n", i, r.Package, r.Version.String())
+	}
+}
+
+// inconsistencyOutput describes a setting which does not match the
+// Release file of the repository.
+type inconsistencyOutput struct {
+	Field string `json:"field" yaml:"field"`
+	Got   string `json:"got" yaml:"got"`
+	Want  string `json:"want" yaml:"want"`
+}
+
+func checkDistCmd(conf debdep.ResolverConfig) {
+	var inconsistencies []inconsistencyOutput
+	err := debdep.CheckReleaseStatus(conf)
+	if err != nil {
+		relData, ok := err.(debdep.ReleaseInconsistency)
+		if !ok {
+			fail("Error", err)
+		}
+		if relData.WantDistro != "" {
+			inconsistencies = append(inconsistencies, inconsistencyOutput{"Distribution", relData.GotDistro, relData.WantDistro})
+		}
+		if relData.WantArch != "" {
+			inconsistencies = append(inconsistencies, inconsistencyOutput{"Arch", relData.GotArch, relData.WantArch})
+		}
+		if relData.WantComponent != "" {
+			inconsistencies = append(inconsistencies, inconsistencyOutput{"Component", relData.GotComponent, relData.WantComponent})
+		}
+	}
+
+	if structuredOutput() {
+		writeOutput(struct {
+			Consistent      bool                  `json:"consistent" yaml:"consistent"`
+			Inconsistencies []inconsistencyOutput `json:"inconsistencies" yaml:"inconsistencies"`
+		}{err == nil, append([]inconsistencyOutput{}, inconsistencies...)})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Configured debian state is inconsistent with the repositories!\n")
+		for _, i := range inconsistencies {
+			fmt.Printf("\t%s = %q (our setting: %q)\n", i.Field, i.Got, i.Want)
 		}
 	}
 }
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/twitchyliquid64/debdep"
+	"gopkg.in/yaml.v2"
+)
+
+var outputFormat = flag.String("output", "text", "Output format of every command: text, json or yaml")
+
+// structuredOutput returns true if output should be written as JSON or YAML
+// rather than text.
+func structuredOutput() bool {
+	return *outputFormat == "json" || *outputFormat == "yaml"
+}
+
+// writeOutput writes v to stdout in the format selected by --output.
+func writeOutput(v interface{}) {
+	switch *outputFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "yaml":
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(b)
+	}
+}
+
+// checkOutputFormat exits if --output is not a known format.
+func checkOutputFormat() {
+	switch *outputFormat {
+	case "text", "json", "yaml":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q, want text, json or yaml\n", *outputFormat)
+		os.Exit(1)
+	}
+}
+
+// errorOutput is written in place of a command's output when it fails.
+type errorOutput struct {
+	Error errorDetail `json:"error" yaml:"error"`
+}
+
+// errorDetail describes an error. Kind is dependency for unsatisfiable
+// dependencies, limit for resolution limits being exceeded, and error
+// otherwise.
+type errorDetail struct {
+	Kind    string `json:"kind" yaml:"kind"`
+	Message string `json:"message" yaml:"message"`
+
+	// Relation, RequiredBy, Chain, Rejected, Excluded, Held and
+	// Alternatives are set for dependency errors.
+	Relation     string        `json:"relation,omitempty" yaml:"relation,omitempty"`
+	RequiredBy   *packageRef   `json:"required_by,omitempty" yaml:"required_by,omitempty"`
+	Chain        []string      `json:"chain,omitempty" yaml:"chain,omitempty"`
+	Rejected     []string      `json:"rejected_versions,omitempty" yaml:"rejected_versions,omitempty"`
+	Excluded     []string      `json:"excluded,omitempty" yaml:"excluded,omitempty"`
+	Held         []string      `json:"held,omitempty" yaml:"held,omitempty"`
+	Alternatives []errorDetail `json:"alternatives,omitempty" yaml:"alternatives,omitempty"`
+
+	// Limit is set for limit errors.
+	Limit string `json:"limit,omitempty" yaml:"limit,omitempty"`
+}
+
+// packageRef identifies a version of a package.
+type packageRef struct {
+	Package string `json:"package" yaml:"package"`
+	Version string `json:"version" yaml:"version"`
+}
+
+func dependencyErrorDetail(e debdep.ErrDependency) errorDetail {
+	out := errorDetail{
+		Kind:     "dependency",
+		Message:  e.Error(),
+		Relation: e.Relation.String(),
+		Rejected: e.Rejected,
+		Excluded: e.Excluded,
+		Held:     e.Held,
+	}
+	if e.RequiredByPackage != "" {
+		out.RequiredBy = &packageRef{Package: e.RequiredByPackage, Version: e.RequiredByVersion}
+	}
+	for _, link := range e.Chain {
+		out.Chain = append(out.Chain, link.String())
+	}
+	for _, alt := range e.Alternatives {
+		out.Alternatives = append(out.Alternatives, dependencyErrorDetail(alt))
+	}
+	return out
+}
+
+// fail reports err and exits. With structured output, the error is written
+// to stdout as an errorOutput. Otherwise, it is written to stderr along with
+// any explanation of an unsatisfiable dependency.
+func fail(prefix string, err error) {
+	if !structuredOutput() {
+		printResolveError(prefix, err)
+		os.Exit(1)
+	}
+
+	writeOutput(errorOutput{Error: newErrorDetail(err)})
+	os.Exit(1)
+}
+
+// newErrorDetail returns the structured description of err.
+func newErrorDetail(err error) errorDetail {
+	detail := errorDetail{Kind: "error", Message: err.Error()}
+	var depErr debdep.ErrDependency
+	var limitErr debdep.ErrLimit
+	switch {
+	case errors.As(err, &depErr):
+		detail = dependencyErrorDetail(depErr)
+		detail.Message = err.Error()
+	case errors.As(err, &limitErr):
+		detail.Kind, detail.Limit = "limit", limitErr.Limit
+	}
+	return detail
+}
+
+// operationOutput describes an operation in an install graph.
+type operationOutput struct {
+	Kind         string            `json:"kind" yaml:"kind"`
+	Package      string            `json:"package,omitempty" yaml:"package,omitempty"`
+	Version      string            `json:"version,omitempty" yaml:"version,omitempty"`
+	Arch         string            `json:"arch,omitempty" yaml:"arch,omitempty"`
+	PreDep       bool              `json:"pre_depends,omitempty" yaml:"pre_depends,omitempty"`
+	Dependencies []operationOutput `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+}
+
+func newOperationOutput(op *debdep.Operation) operationOutput {
+	out := operationOutput{Kind: op.Kind.String()}
+	if op.Kind == debdep.CompositeDependencyOp {
+		for _, dep := range op.DependentOperations {
+			out.Dependencies = append(out.Dependencies, newOperationOutput(dep))
+		}
+		return out
+	}
+	out.Package = op.Package
+	out.Version = op.Version.String()
+	out.Arch = op.Arch
+	out.PreDep = op.PreDep
+	return out
+}
+
+// stepOutput is a step of a bootstrap sequence. Batch is set with --batches,
+// and Action (unpack or configure) with --phases.
+type stepOutput struct {
+	Index   int    `json:"index" yaml:"index"`
+	Batch   *int   `json:"batch,omitempty" yaml:"batch,omitempty"`
+	Action  string `json:"action,omitempty" yaml:"action,omitempty"`
+	Package string `json:"package" yaml:"package"`
+	Version string `json:"version" yaml:"version"`
+	Arch    string `json:"arch,omitempty" yaml:"arch,omitempty"`
+	PreDep  bool   `json:"pre_depends" yaml:"pre_depends"`
+
+	InstalledSize int64 `json:"installed_size" yaml:"installed_size"`
+	DownloadSize  int64 `json:"download_size" yaml:"download_size"`
+}
+
+// linkOutput is a link in a chain of requirements. Field and Relation are
+// unset for the last link, which is the package required.
+type linkOutput struct {
+	Package  string `json:"package" yaml:"package"`
+	Version  string `json:"version" yaml:"version"`
+	Field    string `json:"field,omitempty" yaml:"field,omitempty"`
+	Relation string `json:"relation,omitempty" yaml:"relation,omitempty"`
+}
+
+func newLinkOutputs(chain debdep.WhyChain) []linkOutput {
+	out := make([]linkOutput, len(chain))
+	for i, link := range chain {
+		out[i] = linkOutput{Package: link.Package, Version: link.Version.String(), Field: link.Field}
+		if link.Field != "" {
+			out[i].Relation = link.Relation.String()
+		}
+	}
+	return out
+}
+
+// removalOutput describes a package to be removed. Reason is unset for
+// autoremove.
+type removalOutput struct {
+	Package string `json:"package" yaml:"package"`
+	Version string `json:"version" yaml:"version"`
+	Reason  string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+func newRemovalOutputs(removals []debdep.Removal) []removalOutput {
+	out := []removalOutput{}
+	for _, r := range removals {
+		out = append(out, removalOutput{r.Package, r.Version.String(), r.Reason})
+	}
+	return out
+}
+
+// upgradeOutput describes a package to be upgraded.
+type upgradeOutput struct {
+	Package string `json:"package" yaml:"package"`
+	From    string `json:"from" yaml:"from"`
+	To      string `json:"to" yaml:"to"`
+}
+
+// planStepOutput is an operation of an upgrade plan. Action is install or
+// remove.
+type planStepOutput struct {
+	Index   int    `json:"index" yaml:"index"`
+	Action  string `json:"action" yaml:"action"`
+	Package string `json:"package" yaml:"package"`
+	Version string `json:"version" yaml:"version"`
+	Arch    string `json:"arch,omitempty" yaml:"arch,omitempty"`
+}
+
+// upgradePlanOutput describes an upgrade plan.
+type upgradePlanOutput struct {
+	Upgrades   []upgradeOutput  `json:"upgrades" yaml:"upgrades"`
+	New        []packageRef     `json:"new" yaml:"new"`
+	Removals   []removalOutput  `json:"removals" yaml:"removals"`
+	KeptBack   []errorDetail    `json:"kept_back" yaml:"kept_back"`
+	Operations []planStepOutput `json:"operations" yaml:"operations"`
+}
+
+func newUpgradePlanOutput(plan *debdep.UpgradePlan) upgradePlanOutput {
+	out := upgradePlanOutput{
+		Upgrades:   []upgradeOutput{},
+		New:        []packageRef{},
+		Removals:   newRemovalOutputs(plan.Removals),
+		KeptBack:   []errorDetail{},
+		Operations: []planStepOutput{},
+	}
+	for _, u := range plan.Upgrades {
+		out.Upgrades = append(out.Upgrades, upgradeOutput{u.Package, u.From.String(), u.To.String()})
+	}
+	for _, op := range plan.New {
+		out.New = append(out.New, packageRef{op.Package, op.Version.String()})
+	}
+	for _, k := range plan.KeptBack {
+		out.KeptBack = append(out.KeptBack, dependencyErrorDetail(k))
+	}
+	for i, op := range plan.Operations {
+		action := "install"
+		if op.Kind == debdep.DebPackageRemoveOp {
+			action = "remove"
+		}
+		out.Operations = append(out.Operations, planStepOutput{i, action, op.Package, op.Version.String(), op.Arch})
+	}
+	return out
+}
+
+// downloadOutput describes the outcome of downloading a package. Status is
+// downloaded, not-modified or error.
+type downloadOutput struct {
+	Package string `json:"package" yaml:"package"`
+	Version string `json:"version" yaml:"version"`
+	URL     string `json:"url,omitempty" yaml:"url,omitempty"`
+	Path    string `json:"path,omitempty" yaml:"path,omitempty"`
+	Status  string `json:"status" yaml:"status"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
@@ -0,0 +1,146 @@
+package debdep
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/twitchyliquid64/debdep/deb"
+
+	version "github.com/knqyf263/go-deb-version"
+)
+
+// PackageChange describes a package whose presence or version differs
+// between two install graphs.
+type PackageChange struct {
+	Package string
+	// OldVersion is unset for added packages, and NewVersion is unset
+	// for removed packages.
+	OldVersion version.Version
+	NewVersion version.Version
+
+	// InstalledSizeDelta and DownloadSizeDelta are the changes in the
+	// installed size and package file size, in bytes.
+	InstalledSizeDelta int64
+	DownloadSizeDelta  int64
+}
+
+// GraphDiff describes the differences between two install graphs. Each
+// list is sorted by package name.
+type GraphDiff struct {
+	Added      []PackageChange
+	Removed    []PackageChange
+	Upgraded   []PackageChange
+	Downgraded []PackageChange
+
+	// InstalledSizeDelta and DownloadSizeDelta are the changes in the
+	// total installed size and package file size, in bytes.
+	InstalledSizeDelta int64
+	DownloadSizeDelta  int64
+}
+
+// graphPackages returns the packages installed by the graph, keyed by
+// the name they are stored under in info.Packages.
+func graphPackages(info *PackageInfo, graph *Operation) (map[string]*deb.Paragraph, error) {
+	out := map[string]*deb.Paragraph{}
+	for _, op := range graph.Unroll() {
+		pkg, ok := info.Packages[op.Package][op.Version]
+		if !ok {
+			return nil, fmt.Errorf("package %q (%s) not present in package info", op.Package, op.Version.String())
+		}
+		out[op.Package] = pkg
+	}
+	return out, nil
+}
+
+// DiffGraphs compares two install graphs, which were computed using the
+// package info oldInfo and newInfo respectively.
+func DiffGraphs(oldInfo *PackageInfo, oldGraph *Operation, newInfo *PackageInfo, newGraph *Operation) (*GraphDiff, error) {
+	oldPkgs, err := graphPackages(oldInfo, oldGraph)
+	if err != nil {
+		return nil, err
+	}
+	newPkgs, err := graphPackages(newInfo, newGraph)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for n := range oldPkgs {
+		names[n] = true
+	}
+	for n := range newPkgs {
+		names[n] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+
+	out := &GraphDiff{}
+	for _, name := range sorted {
+		change := PackageChange{Package: name}
+		oldPkg, newPkg := oldPkgs[name], newPkgs[name]
+		if oldPkg != nil {
+			if change.OldVersion, err = oldPkg.Version(); err != nil {
+				return nil, err
+			}
+			installed, download, err := packageSizes(oldPkg)
+			if err != nil {
+				return nil, err
+			}
+			change.InstalledSizeDelta -= installed
+			change.DownloadSizeDelta -= download
+		}
+		if newPkg != nil {
+			if change.NewVersion, err = newPkg.Version(); err != nil {
+				return nil, err
+			}
+			installed, download, err := packageSizes(newPkg)
+			if err != nil {
+				return nil, err
+			}
+			change.InstalledSizeDelta += installed
+			change.DownloadSizeDelta += download
+		}
+
+		switch {
+		case oldPkg == nil:
+			out.Added = append(out.Added, change)
+		case newPkg == nil:
+			out.Removed = append(out.Removed, change)
+		case change.NewVersion.GreaterThan(change.OldVersion):
+			out.Upgraded = append(out.Upgraded, change)
+		case change.NewVersion.LessThan(change.OldVersion):
+			out.Downgraded = append(out.Downgraded, change)
+		default:
+			continue // Unchanged.
+		}
+		out.InstalledSizeDelta += change.InstalledSizeDelta
+		out.DownloadSizeDelta += change.DownloadSizeDelta
+	}
+	return out, nil
+}
+
+// DiffInstallGraphs resolves the targets against two sets of package info,
+// such as two snapshots of a repository, and compares the install graphs.
+// Targets are resolved as by InstallGraphMulti.
+func DiffInstallGraphs(oldInfo, newInfo *PackageInfo, targets []string, installed *PackageInfo, opts ResolveOptions) (*GraphDiff, error) {
+	return DiffInstallGraphsContext(context.Background(), oldInfo, newInfo, targets, installed, opts)
+}
+
+// DiffInstallGraphsContext is like DiffInstallGraphs, but resolution is
+// abandoned with an ErrLimit if ctx is done or a limit set in opts is
+// exceeded.
+func DiffInstallGraphsContext(ctx context.Context, oldInfo, newInfo *PackageInfo, targets []string, installed *PackageInfo, opts ResolveOptions) (*GraphDiff, error) {
+	oldGraph, err := oldInfo.InstallGraphMultiContext(ctx, targets, installed, opts)
+	if err != nil {
+		return nil, fmt.Errorf("old packages: %w", err)
+	}
+	newGraph, err := newInfo.InstallGraphMultiContext(ctx, targets, installed, opts)
+	if err != nil {
+		return nil, fmt.Errorf("new packages: %w", err)
+	}
+	return DiffGraphs(oldInfo, oldGraph, newInfo, newGraph)
+}
@@ -0,0 +1,67 @@
+package debdep
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDiffInstallGraphs(t *testing.T) {
+	oldPkgs := makePkgInfo(t,
+		map[string]string{"Package": "app", "Version": "1", "Depends": "lib, gone, down", "Installed-Size": "10", "Size": "1000"},
+		map[string]string{"Package": "lib", "Version": "1.0-1", "Installed-Size": "100", "Size": "5000"},
+		map[string]string{"Package": "gone", "Version": "1", "Installed-Size": "4", "Size": "200"},
+		map[string]string{"Package": "down", "Version": "2"},
+	)
+	newPkgs := makePkgInfo(t,
+		map[string]string{"Package": "app", "Version": "1", "Depends": "lib, extra, down", "Installed-Size": "10", "Size": "1000"},
+		map[string]string{"Package": "lib", "Version": "1.1-1", "Installed-Size": "150", "Size": "6000"},
+		map[string]string{"Package": "extra", "Version": "3", "Installed-Size": "1", "Size": "100"},
+		map[string]string{"Package": "down", "Version": "1"},
+	)
+
+	diff, err := DiffInstallGraphs(oldPkgs, newPkgs, []string{"app"}, &PackageInfo{}, ResolveOptions{})
+	if err != nil {
+		t.Fatalf("DiffInstallGraphs() failed: %v", err)
+	}
+
+	summary := func(changes []PackageChange) []string {
+		var out []string
+		for _, c := range changes {
+			out = append(out, c.Package+" "+c.OldVersion.String()+" "+c.NewVersion.String())
+		}
+		return out
+	}
+	if got, want := summary(diff.Added), []string{"extra  3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Added = %q, want %q", got, want)
+	}
+	if got, want := summary(diff.Removed), []string{"gone 1 "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Removed = %q, want %q", got, want)
+	}
+	if got, want := summary(diff.Upgraded), []string{"lib 1.0-1 1.1-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Upgraded = %q, want %q", got, want)
+	}
+	if got, want := summary(diff.Downgraded), []string{"down 2 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Downgraded = %q, want %q", got, want)
+	}
+
+	if got := diff.Upgraded[0].InstalledSizeDelta; got != 50*1024 {
+		t.Errorf("lib InstalledSizeDelta = %d, want %d", got, 50*1024)
+	}
+	if want := int64((50 + 1 - 4) * 1024); diff.InstalledSizeDelta != want {
+		t.Errorf("InstalledSizeDelta = %d, want %d", diff.InstalledSizeDelta, want)
+	}
+	if want := int64(1000 + 100 - 200); diff.DownloadSizeDelta != want {
+		t.Errorf("DownloadSizeDelta = %d, want %d", diff.DownloadSizeDelta, want)
+	}
+}
+
+func TestDiffInstallGraphsError(t *testing.T) {
+	oldPkgs := makePkgInfo(t, map[string]string{"Package": "app", "Version": "1"})
+	newPkgs := makePkgInfo(t, map[string]string{"Package": "app", "Version": "2", "Depends": "missing"})
+
+	_, err := DiffInstallGraphs(oldPkgs, newPkgs, []string{"app"}, &PackageInfo{}, ResolveOptions{})
+	if _, ok := errors.Unwrap(err).(ErrDependency); !ok {
+		t.Errorf("DiffInstallGraphs() error = %v, want wrapped ErrDependency", err)
+	}
+}
@@ -0,0 +1,103 @@
+package debdep
+
+import (
+	"os"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+// Reasons a package may not be installed, as returned by blocked.
+const (
+	blockedExcluded = "excluded"
+	blockedHeld     = "held"
+)
+
+// nameSet returns a set of the given package names.
+func nameSet(names []string) map[string]bool {
+	out := make(map[string]bool, len(names))
+	for _, n := range names {
+		out[n] = true
+	}
+	return out
+}
+
+// listed returns true if pkg is named in set, either by name alone or
+// qualified with its architecture.
+func listed(set map[string]bool, pkg *deb.Paragraph) bool {
+	return listedName(set, pkg.Name(), pkg.Arch())
+}
+
+// listedName returns true if the package of the given name and
+// architecture is named in set, either by name alone or qualified with its
+// architecture.
+func listedName(set map[string]bool, name, arch string) bool {
+	return set[name] || set[name+":"+arch]
+}
+
+// isProvided returns true if req, when declared by a package of
+// architecture parentArch, names a package listed in ResolveOptions.Provided.
+func (p *PackageInfo) isProvided(state *resolveState, req deb.Requirement, parentArch string) bool {
+	arch := parentArch
+	switch {
+	case req.ArchConstraint.Arch != "" && !req.ArchConstraint.Any:
+		arch = req.ArchConstraint.Arch
+	case req.ArchConstraint.Native || arch == "" || arch == anyArch:
+		arch = p.Config.Arch.Arch
+	}
+	return listedName(state.provided, req.Package, arch)
+}
+
+// blocked returns why pkg may not be installed, or the empty string if it
+// may be.
+func (s *resolveState) blocked(pkg *deb.Paragraph) string {
+	switch {
+	case listed(s.excluded, pkg):
+		return blockedExcluded
+	case listed(s.held, pkg):
+		return blockedHeld
+	}
+	return ""
+}
+
+// findAllowedRelation is like findRelation, but skips packages which may
+// not be installed. If no package can satisfy req, os.ErrNotExist is
+// returned along with any candidates which were skipped.
+func (p *PackageInfo) findAllowedRelation(state *resolveState, req deb.Requirement, parentArch string) (*deb.Paragraph, []*deb.Paragraph, error) {
+	if len(state.excluded) == 0 && len(state.held) == 0 {
+		pkg, err := p.findRelation(req, parentArch)
+		return pkg, nil, err
+	}
+
+	groups, err := p.relationCandidates(req, parentArch)
+	if err != nil {
+		return nil, nil, err
+	}
+	var blocked []*deb.Paragraph
+	for _, group := range groups {
+		var allowed []*deb.Paragraph
+		for _, pkg := range group {
+			if state.blocked(pkg) == "" {
+				allowed = append(allowed, pkg)
+			} else {
+				blocked = append(blocked, pkg)
+			}
+		}
+		pkg, err := p.bestCandidate(allowed)
+		if err == os.ErrNotExist {
+			continue
+		}
+		return pkg, nil, err
+	}
+	return nil, blocked, os.ErrNotExist
+}
+
+// addBlocked records that pkg could not be chosen for the given reason.
+func (e *ErrDependency) addBlocked(p *PackageInfo, reason string, pkg *deb.Paragraph) {
+	desc := p.QualifiedName(pkg.Name(), pkg.Arch()) + " (" + pkg.Values["Version"] + ")"
+	switch reason {
+	case blockedExcluded:
+		e.Excluded = append(e.Excluded, desc)
+	case blockedHeld:
+		e.Held = append(e.Held, desc)
+	}
+}
@@ -0,0 +1,125 @@
+package debdep
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func graphPackageNames(t *testing.T, graph *Operation) []string {
+	t.Helper()
+	var out []string
+	for _, op := range graph.Unroll() {
+		out = append(out, op.Package)
+	}
+	return out
+}
+
+func TestInstallGraphExclude(t *testing.T) {
+	pkgs := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "1", "Depends": "b | c, mta"},
+		map[string]string{"Package": "b", "Version": "1"},
+		map[string]string{"Package": "c", "Version": "1"},
+		map[string]string{"Package": "exim", "Version": "1", "Provides": "mta"},
+		map[string]string{"Package": "postfix", "Version": "1", "Provides": "mta"},
+	)
+
+	graph, err := pkgs.InstallGraphMulti([]string{"a"}, &PackageInfo{}, ResolveOptions{Exclude: []string{"b", "exim"}})
+	if err != nil {
+		t.Fatalf("InstallGraphMulti() failed: %v", err)
+	}
+	if got, want := graphPackageNames(t, graph), []string{"c", "postfix", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallGraphMulti() = %v, want %v", got, want)
+	}
+
+	_, err = pkgs.InstallGraphMulti([]string{"a"}, &PackageInfo{}, ResolveOptions{Exclude: []string{"exim"}, Hold: []string{"postfix"}})
+	depErr, ok := err.(ErrDependency)
+	if !ok {
+		t.Fatalf("InstallGraphMulti() error = %v, want ErrDependency", err)
+	}
+	if want := []string{"exim (1)"}; !reflect.DeepEqual(depErr.Excluded, want) {
+		t.Errorf("Excluded = %v, want %v", depErr.Excluded, want)
+	}
+	if want := []string{"postfix (1)"}; !reflect.DeepEqual(depErr.Held, want) {
+		t.Errorf("Held = %v, want %v", depErr.Held, want)
+	}
+
+	if _, err := pkgs.InstallGraphMulti([]string{"a"}, &PackageInfo{}, ResolveOptions{Exclude: []string{"a"}}); err == nil {
+		t.Error("InstallGraphMulti() succeeded for an excluded target, want error")
+	}
+	if _, err := pkgs.InstallGraphContext(context.Background(), "a", &PackageInfo{}, ResolveOptions{Exclude: []string{"a"}}); err == nil {
+		t.Error("InstallGraphContext() succeeded for an excluded target, want error")
+	}
+}
+
+func TestInstallGraphProvided(t *testing.T) {
+	pkgs := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "1", "Depends": "systemd (>= 240), lib"},
+		map[string]string{"Package": "systemd", "Version": "241", "Depends": "lib"},
+		map[string]string{"Package": "lib", "Version": "1"},
+	)
+
+	graph, err := pkgs.InstallGraphMulti([]string{"a"}, &PackageInfo{}, ResolveOptions{Provided: []string{"systemd"}})
+	if err != nil {
+		t.Fatalf("InstallGraphMulti() failed: %v", err)
+	}
+	if got, want := graphPackageNames(t, graph), []string{"lib", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallGraphMulti() = %v, want %v", got, want)
+	}
+}
+
+func TestPlanUpgradeHold(t *testing.T) {
+	installed := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "1"},
+		map[string]string{"Package": "b", "Version": "1"},
+	)
+	repo := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "2"},
+		map[string]string{"Package": "b", "Version": "2"},
+	)
+
+	plan, err := repo.PlanUpgrade(installed, ResolveOptions{Hold: []string{"a"}})
+	if err != nil {
+		t.Fatalf("PlanUpgrade() failed: %v", err)
+	}
+	if len(plan.Upgrades) != 1 || plan.Upgrades[0].Package != "b" {
+		t.Errorf("Upgrades = %+v, want only b", plan.Upgrades)
+	}
+	if len(plan.KeptBack) != 1 || !reflect.DeepEqual(plan.KeptBack[0].Held, []string{"a (2)"}) {
+		t.Errorf("KeptBack = %+v, want a kept back as held", plan.KeptBack)
+	}
+}
+
+func TestResolveOptionsQualifiedNames(t *testing.T) {
+	pkgs := makeConfiguredPkgInfo(t, multiarchConfig,
+		map[string]string{"Package": "app", "Version": "1", "Architecture": "amd64", "Depends": "systemd (>= 240), lib"},
+		map[string]string{"Package": "systemd", "Version": "241", "Architecture": "amd64"},
+		map[string]string{"Package": "lib", "Version": "1", "Architecture": "amd64"},
+		map[string]string{"Package": "dash", "Version": "0.5", "Architecture": "amd64", "Essential": "yes"},
+		map[string]string{"Package": "coreutils", "Version": "8.30", "Architecture": "amd64", "Essential": "yes"},
+	)
+
+	opts := ResolveOptions{
+		Essential: true,
+		Exclude:   []string{"dash:amd64"},
+		Hold:      []string{"coreutils:amd64"},
+		Provided:  []string{"systemd:amd64"},
+	}
+	graph, err := pkgs.InstallGraphMulti([]string{"app"}, &PackageInfo{}, opts)
+	if err != nil {
+		t.Fatalf("InstallGraphMulti() failed: %v", err)
+	}
+	if got, want := graphPackageNames(t, graph), []string{"lib", "app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallGraphMulti() = %v, want %v", got, want)
+	}
+
+	// Packages qualified with another architecture are not affected.
+	opts.Provided = []string{"systemd:i386"}
+	graph, err = pkgs.InstallGraphMulti([]string{"app"}, &PackageInfo{}, opts)
+	if err != nil {
+		t.Fatalf("InstallGraphMulti() failed: %v", err)
+	}
+	if got, want := graphPackageNames(t, graph), []string{"systemd", "lib", "app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallGraphMulti() = %v, want %v", got, want)
+	}
+}
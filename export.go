@@ -0,0 +1,218 @@
+package debdep
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+// Graph is a flattened install graph, suitable for export to other tools.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes" yaml:"nodes"`
+	Edges []GraphEdge `json:"edges" yaml:"edges"`
+}
+
+// GraphNode is a package in an install graph.
+type GraphNode struct {
+	// ID is the name the package is stored under in PackageInfo.Packages,
+	// which is unique within the graph.
+	ID      string `json:"id" yaml:"id"`
+	Package string `json:"package" yaml:"package"`
+	Version string `json:"version" yaml:"version"`
+	Arch    string `json:"arch" yaml:"arch"`
+	// PreDep is true if the package is needed by a Pre-Depends relation.
+	PreDep bool `json:"pre_depends" yaml:"pre_depends"`
+}
+
+// GraphEdge is a relation of one package in an install graph, which is
+// satisfied by another package in the graph.
+type GraphEdge struct {
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+	// Field is the control field the relation came from, such as Depends.
+	Field string `json:"field" yaml:"field"`
+	// Relation is the group of alternatives which To was chosen from.
+	Relation string `json:"relation" yaml:"relation"`
+	// Alternatives is true if Relation offers a choice of packages.
+	Alternatives bool `json:"alternatives" yaml:"alternatives"`
+}
+
+// ExportGraph flattens the install graph into its packages, and the
+// relations between them. Relations satisfied by packages outside of the
+// graph (such as those already installed) do not produce edges.
+func (p *PackageInfo) ExportGraph(graph *Operation) (*Graph, error) {
+	edges, err := p.InstallEdges(graph)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, op := range graph.Unroll() {
+		pkg := p.Packages[op.Package][op.Version]
+		out.Nodes = append(out.Nodes, GraphNode{
+			ID:      op.Package,
+			Package: pkg.Name(),
+			Version: op.Version.String(),
+			Arch:    pkg.Arch(),
+			PreDep:  op.PreDep,
+		})
+	}
+	for _, e := range edges {
+		out.Edges = append(out.Edges, GraphEdge{
+			From:         e.From,
+			To:           e.To,
+			Field:        e.Field,
+			Relation:     e.Relation.String(),
+			Alternatives: e.Relation.Kind == deb.OrCompositeRequirement,
+		})
+	}
+	return out, nil
+}
+
+// WriteJSON writes the graph as a JSON object, with nodes and edges arrays.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// dotEscape escapes s for use within a quoted Graphviz DOT string.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// dotQuote returns s as a quoted Graphviz DOT string.
+func dotQuote(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. Packages needed
+// by Pre-Depends relations, and their Pre-Depends edges, are drawn in bold.
+// Edges chosen from a set of alternatives are dashed and labelled with the
+// alternatives.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph debdep {\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, n := range g.Nodes {
+		attrs := []string{`label="` + dotEscape(n.ID) + `\n` + dotEscape(n.Version) + `"`}
+		if n.PreDep {
+			attrs = append(attrs, "style=bold")
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(n.ID), strings.Join(attrs, ", "))
+	}
+	for _, e := range g.Edges {
+		label := e.Field
+		var styles []string
+		if e.Field == "Pre-Depends" {
+			styles = append(styles, "bold")
+		}
+		if e.Alternatives {
+			label += ": " + e.Relation
+			styles = append(styles, "dashed")
+		}
+		attrs := []string{"label=" + dotQuote(label)}
+		if len(styles) > 0 {
+			attrs = append(attrs, "style="+dotQuote(strings.Join(styles, ",")))
+		}
+		if e.Field == "Pre-Depends" {
+			attrs = append(attrs, "color=red")
+		}
+		fmt.Fprintf(&b, "  %s -> %s [%s];\n", dotQuote(e.From), dotQuote(e.To), strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// WriteGraphML writes the graph as a GraphML document. The fields of nodes
+// and edges are written as data attributes, named as in the JSON output.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphMLDocument{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "package", For: "node", Name: "package", Type: "string"},
+			{ID: "version", For: "node", Name: "version", Type: "string"},
+			{ID: "arch", For: "node", Name: "arch", Type: "string"},
+			{ID: "pre_depends", For: "node", Name: "pre_depends", Type: "boolean"},
+			{ID: "field", For: "edge", Name: "field", Type: "string"},
+			{ID: "relation", For: "edge", Name: "relation", Type: "string"},
+			{ID: "alternatives", For: "edge", Name: "alternatives", Type: "boolean"},
+		},
+	}
+	doc.Graph.ID = "debdep"
+	doc.Graph.EdgeDefault = "directed"
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: n.ID,
+			Data: []graphMLData{
+				{Key: "package", Value: n.Package},
+				{Key: "version", Value: n.Version},
+				{Key: "arch", Value: n.Arch},
+				{Key: "pre_depends", Value: strconv.FormatBool(n.PreDep)},
+			},
+		})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: e.From,
+			Target: e.To,
+			Data: []graphMLData{
+				{Key: "field", Value: e.Field},
+				{Key: "relation", Value: e.Relation},
+				{Key: "alternatives", Value: strconv.FormatBool(e.Alternatives)},
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
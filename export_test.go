@@ -0,0 +1,98 @@
+package debdep
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func exportTestGraph(t *testing.T) *Graph {
+	t.Helper()
+	pkgs := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "1", "Architecture": "amd64", "Pre-Depends": "pre", "Depends": "b | c"},
+		map[string]string{"Package": "pre", "Version": "2", "Architecture": "all"},
+		map[string]string{"Package": "b", "Version": "1.0-1", "Architecture": "amd64"},
+		map[string]string{"Package": "c", "Version": "1", "Architecture": "amd64"},
+	)
+	graph, err := pkgs.InstallGraph("a", &PackageInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := pkgs.ExportGraph(graph)
+	if err != nil {
+		t.Fatalf("ExportGraph() failed: %v", err)
+	}
+	return g
+}
+
+func TestExportGraph(t *testing.T) {
+	g := exportTestGraph(t)
+
+	wantNodes := []GraphNode{
+		{ID: "pre", Package: "pre", Version: "2", Arch: "all", PreDep: true},
+		{ID: "b", Package: "b", Version: "1.0-1", Arch: "amd64"},
+		{ID: "a", Package: "a", Version: "1", Arch: "amd64"},
+	}
+	if !reflect.DeepEqual(g.Nodes, wantNodes) {
+		t.Errorf("Nodes = %+v, want %+v", g.Nodes, wantNodes)
+	}
+	wantEdges := []GraphEdge{
+		{From: "a", To: "pre", Field: "Pre-Depends", Relation: "pre"},
+		{From: "a", To: "b", Field: "Depends", Relation: "b | c", Alternatives: true},
+	}
+	if !reflect.DeepEqual(g.Edges, wantEdges) {
+		t.Errorf("Edges = %+v, want %+v", g.Edges, wantEdges)
+	}
+}
+
+func TestGraphWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportTestGraph(t).WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`  "pre" [label="pre\n2", style=bold];`,
+		`  "a" -> "pre" [label="Pre-Depends", style="bold", color=red];`,
+		`  "a" -> "b" [label="Depends: b | c", style="dashed"];`,
+	} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Errorf("WriteDOT() output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestGraphWriteJSON(t *testing.T) {
+	g := exportTestGraph(t)
+	var buf bytes.Buffer
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got Graph
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("WriteJSON() produced invalid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(&got, g) {
+		t.Errorf("WriteJSON() round-tripped to %+v, want %+v", got, g)
+	}
+}
+
+func TestGraphWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportTestGraph(t).WriteGraphML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var doc graphMLDocument
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("WriteGraphML() produced invalid XML: %v", err)
+	}
+	if len(doc.Graph.Nodes) != 3 || len(doc.Graph.Edges) != 2 {
+		t.Fatalf("WriteGraphML() wrote %d nodes and %d edges, want 3 and 2", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+	edge := doc.Graph.Edges[1]
+	if edge.Source != "a" || edge.Target != "b" || edge.Data[1] != (graphMLData{Key: "relation", Value: "b | c"}) {
+		t.Errorf("second edge = %+v, want a -> b with relation b | c", edge)
+	}
+}
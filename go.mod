@@ -6,4 +6,5 @@ require (
 	github.com/blakesmith/ar v0.0.0-20190502131153-809d4375e1fb
 	github.com/knqyf263/go-deb-version v0.0.0-20190517075300-09fca494f03d
 	github.com/ulikunitz/xz v0.5.6
+	gopkg.in/yaml.v2 v2.4.0
 )
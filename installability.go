@@ -0,0 +1,127 @@
+package debdep
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/twitchyliquid64/debdep/deb"
+
+	version "github.com/knqyf263/go-deb-version"
+)
+
+// InstallabilityOptions configures CheckInstallability.
+type InstallabilityOptions struct {
+	// Workers is the number of packages to resolve concurrently. If zero,
+	// one worker is used per CPU.
+	Workers int
+
+	// ResolveOptions configures how each package is resolved. Limits
+	// apply to each package separately.
+	ResolveOptions
+}
+
+// Uninstallable describes a package which cannot be installed.
+type Uninstallable struct {
+	// Package is the name the package is stored under in
+	// PackageInfo.Packages.
+	Package string
+	Version version.Version
+	// Err describes why the package cannot be installed, and is usually
+	// an ErrDependency.
+	Err error
+}
+
+// CheckInstallability attempts to resolve every version of every package,
+// similar to dose-distcheck, and returns those which cannot be installed
+// alongside the installed packages, sorted by name and version. Versions
+// with a negative priority are skipped, as they are never chosen.
+//
+// As the resolver does not backtrack, a package is reported if the
+// alternatives chosen for it cannot be satisfied, even if other choices
+// would succeed. Conflicts between the chosen packages are not checked.
+func (p *PackageInfo) CheckInstallability(installed *PackageInfo, opts InstallabilityOptions) ([]Uninstallable, error) {
+	return p.CheckInstallabilityContext(context.Background(), installed, opts)
+}
+
+// CheckInstallabilityContext is like CheckInstallability, but checking is
+// abandoned with an ErrLimit if ctx is done.
+func (p *PackageInfo) CheckInstallabilityContext(ctx context.Context, installed *PackageInfo, opts InstallabilityOptions) ([]Uninstallable, error) {
+	if installed == nil {
+		installed = &PackageInfo{}
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	work := make(chan *deb.Paragraph)
+	var (
+		mu  sync.Mutex
+		out []Uninstallable
+		wg  sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pkg := range work {
+				if err := p.checkInstallable(ctx, pkg, installed, opts.ResolveOptions); err != nil {
+					v, _ := pkg.Version()
+					mu.Lock()
+					out = append(out, Uninstallable{Package: p.QualifiedName(pkg.Name(), pkg.Arch()), Version: v, Err: err})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, name := range p.names() {
+		versions := p.Packages[name]
+		for _, v := range sortedVersions(versions) {
+			if ctx.Err() != nil {
+				break feed
+			}
+			if pkg := versions[v]; p.Priority(pkg) >= 0 {
+				work <- pkg
+			}
+		}
+	}
+	close(work)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, ErrLimit{Limit: LimitContext, Err: err}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Package != out[j].Package {
+			return out[i].Package < out[j].Package
+		}
+		return out[i].Version.LessThan(out[j].Version)
+	})
+	return out, nil
+}
+
+// checkInstallable resolves the given package, returning an error if it
+// cannot be installed.
+func (p *PackageInfo) checkInstallable(ctx context.Context, pkg *deb.Paragraph, installed *PackageInfo, opts ResolveOptions) error {
+	v, err := pkg.Version()
+	if err != nil {
+		return err
+	}
+	req := deb.Requirement{
+		Kind:              deb.PackageRelationRequirement,
+		Package:           pkg.Name(),
+		VersionConstraint: &deb.VersionConstraint{ConstraintRelation: deb.ConstraintEquals, Version: v.String()},
+	}
+	if p.QualifiedName(pkg.Name(), pkg.Arch()) != pkg.Name() {
+		req.ArchConstraint = deb.Arch{Arch: pkg.Arch()}
+	}
+
+	state, cancel := newResolveState(ctx, installed, opts)
+	defer cancel()
+	_, err = p.buildInstallGraphRequirement(state, req, "", nil, false)
+	return err
+}
@@ -0,0 +1,48 @@
+package debdep
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCheckInstallability(t *testing.T) {
+	pkgs := makePkgInfo(t,
+		map[string]string{"Package": "ok", "Version": "1", "Depends": "lib"},
+		map[string]string{"Package": "lib", "Version": "1"},
+		map[string]string{"Package": "lib", "Version": "2", "Depends": "missing"},
+		map[string]string{"Package": "broken", "Version": "1", "Depends": "lib (>= 3)"},
+		map[string]string{"Package": "chain", "Version": "1", "Depends": "broken | missing"},
+	)
+
+	got, err := pkgs.CheckInstallability(&PackageInfo{}, InstallabilityOptions{Workers: 4})
+	if err != nil {
+		t.Fatalf("CheckInstallability() failed: %v", err)
+	}
+
+	var names []string
+	for _, u := range got {
+		names = append(names, u.Package+" "+u.Version.String())
+		if _, ok := u.Err.(ErrDependency); !ok {
+			t.Errorf("%s: Err = %v, want ErrDependency", u.Package, u.Err)
+		}
+	}
+	// ok is reported, as the resolver chooses the candidate version of
+	// lib, which cannot be installed, and does not fall back to lib 1.
+	want := []string{"broken 1", "chain 1", "lib 2", "ok 1"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("CheckInstallability() = %v, want %v", names, want)
+	}
+}
+
+func TestCheckInstallabilityCancelled(t *testing.T) {
+	pkgs := makePkgInfo(t, map[string]string{"Package": "a", "Version": "1"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := pkgs.CheckInstallabilityContext(ctx, nil, InstallabilityOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CheckInstallabilityContext() error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,78 @@
+package debdep
+
+import (
+	"context"
+	"fmt"
+)
+
+// Limits which can be exceeded during resolution, as reported by ErrLimit.
+const (
+	LimitDepth   = "depth"
+	LimitNodes   = "nodes"
+	LimitContext = "context"
+)
+
+// ErrLimit is returned when resolution is abandoned, because a limit set in
+// ResolveOptions was exceeded, or the context was cancelled or timed out.
+type ErrLimit struct {
+	// Limit is the limit which was exceeded: LimitDepth, LimitNodes, or
+	// LimitContext if the context was done (including when Timeout passed).
+	Limit string
+	// Max is the configured maximum, for LimitDepth and LimitNodes.
+	Max int
+	// Err is the error of the context, for LimitContext.
+	Err error
+}
+
+func (e ErrLimit) Error() string {
+	switch e.Limit {
+	case LimitDepth:
+		return fmt.Sprintf("resolution abandoned: dependency chain longer than %d packages", e.Max)
+	case LimitNodes:
+		return fmt.Sprintf("resolution abandoned: more than %d relations explored", e.Max)
+	}
+	return fmt.Sprintf("resolution abandoned: %v", e.Err)
+}
+
+// Unwrap returns the error of the context, if any, so errors.Is can be used
+// to test for context.Canceled or context.DeadlineExceeded.
+func (e ErrLimit) Unwrap() error {
+	return e.Err
+}
+
+// newResolveState returns the state for resolving with the given options.
+// The returned function releases resources associated with any Timeout, and
+// must be called once resolution is complete.
+func newResolveState(ctx context.Context, installed *PackageInfo, opts ResolveOptions) (*resolveState, context.CancelFunc) {
+	cancel := func() {}
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	return &resolveState{
+		ctx:       ctx,
+		installed: installed,
+		opts:      opts,
+		excluded:  nameSet(opts.Exclude),
+		held:      nameSet(opts.Hold),
+		provided:  nameSet(opts.Provided),
+	}, cancel
+}
+
+// explore records that a package relation is being evaluated, with the
+// given chain of dependencies leading to it. An ErrLimit is returned if
+// resolution should be abandoned.
+func (s *resolveState) explore(chain WhyChain) error {
+	s.nodes++
+	if s.opts.MaxNodes > 0 && s.nodes > s.opts.MaxNodes {
+		return ErrLimit{Limit: LimitNodes, Max: s.opts.MaxNodes}
+	}
+	if s.opts.MaxDepth > 0 && len(chain) > s.opts.MaxDepth {
+		return ErrLimit{Limit: LimitDepth, Max: s.opts.MaxDepth}
+	}
+	if s.ctx != nil {
+		if err := s.ctx.Err(); err != nil {
+			return ErrLimit{Limit: LimitContext, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package debdep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestInstallGraphLimits(t *testing.T) {
+	// A chain of ten packages, each depending on the next.
+	var chain []map[string]string
+	for i := 0; i < 10; i++ {
+		pkg := map[string]string{"Package": fmt.Sprintf("pkg%d", i), "Version": "1"}
+		if i < 9 {
+			pkg["Depends"] = fmt.Sprintf("pkg%d", i+1)
+		}
+		chain = append(chain, pkg)
+	}
+	pkgs := makePkgInfo(t, chain...)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tcs := []struct {
+		name  string
+		ctx   context.Context
+		opts  ResolveOptions
+		limit string
+	}{
+		{name: "unlimited", ctx: context.Background()},
+		{name: "within limits", ctx: context.Background(), opts: ResolveOptions{MaxDepth: 10, MaxNodes: 9}},
+		{name: "depth", ctx: context.Background(), opts: ResolveOptions{MaxDepth: 3}, limit: LimitDepth},
+		{name: "nodes", ctx: context.Background(), opts: ResolveOptions{MaxNodes: 5}, limit: LimitNodes},
+		{name: "cancelled", ctx: cancelled, limit: LimitContext},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := pkgs.InstallGraphContext(tc.ctx, "pkg0", nil, tc.opts)
+			if tc.limit == "" {
+				if err != nil {
+					t.Fatalf("InstallGraphContext() failed: %v", err)
+				}
+				return
+			}
+			limitErr, ok := err.(ErrLimit)
+			if !ok {
+				t.Fatalf("InstallGraphContext() error = %v, want ErrLimit", err)
+			}
+			if limitErr.Limit != tc.limit {
+				t.Errorf("ErrLimit.Limit = %q, want %q", limitErr.Limit, tc.limit)
+			}
+		})
+	}
+
+	_, err := pkgs.InstallGraphMultiContext(cancelled, []string{"pkg0"}, nil, ResolveOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("InstallGraphMultiContext() error = %v, want context.Canceled", err)
+	}
+}
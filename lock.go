@@ -0,0 +1,124 @@
+package debdep
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	version "github.com/knqyf263/go-deb-version"
+)
+
+// LockfileVersion is the version of the lockfile format written by
+// Lockfile.Write.
+const LockfileVersion = 1
+
+// Lockfile records the exact packages resolved for a set of targets, so
+// that the same set can be fetched later.
+type Lockfile struct {
+	Version  int             `json:"version"`
+	Targets  []string        `json:"targets"`
+	Packages []LockedPackage `json:"packages"`
+}
+
+// LockedPackage is a package recorded in a Lockfile.
+type LockedPackage struct {
+	// Package is the name the package is stored under in
+	// PackageInfo.Packages, so packages of a foreign architecture are
+	// qualified with their architecture, such as libc6:i386.
+	Package string `json:"package"`
+	Version string `json:"version"`
+	Arch    string `json:"arch"`
+	// Filename is the path of the package file in the repository.
+	Filename string `json:"filename"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+}
+
+// Lock returns a Lockfile recording the packages in the install graph,
+// which was computed for the given targets. Packages must have a Filename
+// and SHA256 hash, as is the case for packages from a repository.
+func (p *PackageInfo) Lock(targets []string, graph *Operation) (*Lockfile, error) {
+	pkgs, err := graphPackages(p, graph)
+	if err != nil {
+		return nil, err
+	}
+	out := &Lockfile{Version: LockfileVersion, Targets: targets, Packages: []LockedPackage{}}
+	for _, op := range graph.Unroll() {
+		pkg := pkgs[op.Package]
+		size, err := pkg.Size()
+		if err != nil {
+			return nil, err
+		}
+		locked := LockedPackage{
+			Package:  op.Package,
+			Version:  op.Version.String(),
+			Arch:     pkg.Arch(),
+			Filename: pkg.Values["Filename"],
+			SHA256:   strings.ToLower(pkg.Values["SHA256"]),
+			Size:     size,
+		}
+		if locked.Filename == "" || locked.SHA256 == "" {
+			return nil, fmt.Errorf("package %q (%s) has no Filename or SHA256", op.Package, locked.Version)
+		}
+		out.Packages = append(out.Packages, locked)
+	}
+	return out, nil
+}
+
+// Write writes the lockfile as JSON.
+func (l *Lockfile) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// ReadLockfile reads a lockfile written by Lockfile.Write.
+func ReadLockfile(r io.Reader) (*Lockfile, error) {
+	var out Lockfile
+	if err := json.NewDecoder(r).Decode(&out); err != nil {
+		return nil, err
+	}
+	if out.Version != LockfileVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d", out.Version)
+	}
+	return &out, nil
+}
+
+// CheckLock returns an error describing the locked packages which are no
+// longer available, or whose file differs from the one locked.
+func (p *PackageInfo) CheckLock(l *Lockfile) error {
+	var problems []string
+	for _, locked := range l.Packages {
+		v, err := version.NewVersion(locked.Version)
+		if err != nil {
+			return err
+		}
+		pkg, ok := p.Packages[locked.Package][v]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s (%s) is no longer available", locked.Package, locked.Version))
+		case pkg.Values["Filename"] != locked.Filename || !strings.EqualFold(pkg.Values["SHA256"], locked.SHA256):
+			problems = append(problems, fmt.Sprintf("%s (%s) has changed since it was locked", locked.Package, locked.Version))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("lockfile does not match the repository: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Verify returns an error if the SHA256 hash of the contents of r does
+// not match the locked hash.
+func (l LockedPackage) Verify(r io.Reader) error {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(got, l.SHA256) {
+		return fmt.Errorf("%s (%s): SHA256 is %s, want %s", l.Package, l.Version, got, l.SHA256)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package debdep
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lockTestPkgs(t *testing.T, libHash string) *PackageInfo {
+	t.Helper()
+	return makePkgInfo(t,
+		map[string]string{"Package": "app", "Version": "1", "Architecture": "amd64", "Depends": "lib",
+			"Filename": "pool/main/a/app/app_1_amd64.deb", "SHA256": "AAAA", "Size": "10"},
+		map[string]string{"Package": "lib", "Version": "2", "Architecture": "all",
+			"Filename": "pool/main/l/lib/lib_2_all.deb", "SHA256": libHash, "Size": "20"},
+	)
+}
+
+func TestLock(t *testing.T) {
+	pkgs := lockTestPkgs(t, "bbbb")
+	graph, err := pkgs.InstallGraph("app", &PackageInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := pkgs.Lock([]string{"app"}, graph)
+	if err != nil {
+		t.Fatalf("Lock() failed: %v", err)
+	}
+	want := &Lockfile{
+		Version: LockfileVersion,
+		Targets: []string{"app"},
+		Packages: []LockedPackage{
+			{Package: "lib", Version: "2", Arch: "all", Filename: "pool/main/l/lib/lib_2_all.deb", SHA256: "bbbb", Size: 20},
+			{Package: "app", Version: "1", Arch: "amd64", Filename: "pool/main/a/app/app_1_amd64.deb", SHA256: "aaaa", Size: 10},
+		},
+	}
+	if !reflect.DeepEqual(lock, want) {
+		t.Errorf("Lock() = %+v, want %+v", lock, want)
+	}
+
+	var buf bytes.Buffer
+	if err := lock.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadLockfile(&buf)
+	if err != nil {
+		t.Fatalf("ReadLockfile() failed: %v", err)
+	}
+	if !reflect.DeepEqual(read, want) {
+		t.Errorf("ReadLockfile() = %+v, want %+v", read, want)
+	}
+
+	if err := pkgs.CheckLock(lock); err != nil {
+		t.Errorf("CheckLock() against the same packages failed: %v", err)
+	}
+	if err := lockTestPkgs(t, "cccc").CheckLock(lock); err == nil || !strings.Contains(err.Error(), "lib (2) has changed") {
+		t.Errorf("CheckLock() with a changed package returned %v, want error", err)
+	}
+	gone := makePkgInfo(t, map[string]string{"Package": "app", "Version": "2"})
+	if err := gone.CheckLock(lock); err == nil || !strings.Contains(err.Error(), "app (1) is no longer available") {
+		t.Errorf("CheckLock() with a missing package returned %v, want error", err)
+	}
+}
+
+func TestLockedPackageVerify(t *testing.T) {
+	// The SHA256 of "hello\n".
+	locked := LockedPackage{Package: "a", Version: "1", SHA256: "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"}
+	if err := locked.Verify(strings.NewReader("hello\n")); err != nil {
+		t.Errorf("Verify() failed: %v", err)
+	}
+	if err := locked.Verify(strings.NewReader("tampered\n")); err == nil {
+		t.Error("Verify() succeeded for different contents, want error")
+	}
+}
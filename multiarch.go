@@ -0,0 +1,202 @@
+package debdep
+
+import (
+	"os"
+	"sort"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+// anyArch may be given as the architecture of the package declaring a
+// relation, to match packages of every architecture. It is used for
+// Breaks and Conflicts, which apply to all architectures of the named
+// package unless qualified.
+const anyArch = "any"
+
+// qualifiedName returns the name under which a package is stored, given
+// the native architecture. See PackageInfo.QualifiedName.
+func qualifiedName(native, name, arch string) string {
+	if arch == "" || arch == "all" || native == "" || arch == native {
+		return name
+	}
+	return name + ":" + arch
+}
+
+// effectiveArch returns the architecture a package is treated as when
+// resolving relations. As with dpkg, Architecture: all packages are treated
+// as packages of the native architecture.
+func effectiveArch(pkg *deb.Paragraph, native string) string {
+	if arch := pkg.Arch(); arch != "" && arch != "all" {
+		return arch
+	}
+	return native
+}
+
+// archSatisfies returns true if pkg can satisfy the relation req declared
+// by a package of architecture parentArch, following the Multi-Arch rules:
+//
+//   - relations qualified with an architecture (or :native) only match
+//     packages of that architecture.
+//   - packages of the same architecture as the declaring package always match.
+//   - Multi-Arch: foreign packages match relations from any architecture.
+//   - Multi-Arch: allowed packages match relations qualified with :any.
+//
+// An empty parentArch denotes the native architecture. If the native
+// architecture is not known, only explicit qualifiers are checked.
+func archSatisfies(pkg *deb.Paragraph, req deb.Requirement, parentArch, native string) bool {
+	arch := effectiveArch(pkg, native)
+	switch {
+	case req.ArchConstraint.Native:
+		return native == "" || arch == native
+	case req.ArchConstraint.Arch != "" && !req.ArchConstraint.Any:
+		return arch == req.ArchConstraint.Arch || (native == "" && pkg.Arch() == "all")
+	}
+
+	if parentArch == "" {
+		parentArch = native
+	}
+	if native == "" || parentArch == anyArch || arch == parentArch {
+		return true
+	}
+	if req.ArchConstraint.Any && pkg.MultiarchAllowed() {
+		return true
+	}
+	return pkg.ForeignDepSatisfiable()
+}
+
+// archList returns the architectures packages may be installed for: the
+// native architecture, followed by the foreign architectures in sorted order.
+func (p *PackageInfo) archList() []string {
+	seen := map[string]bool{p.Config.Arch.Arch: true}
+	var foreign []string
+	for _, arch := range p.Config.ForeignArches {
+		if !seen[arch] {
+			seen[arch] = true
+			foreign = append(foreign, arch)
+		}
+	}
+	for arch := range p.foreignArches {
+		if !seen[arch] {
+			seen[arch] = true
+			foreign = append(foreign, arch)
+		}
+	}
+	sort.Strings(foreign)
+	return append([]string{p.Config.Arch.Arch}, foreign...)
+}
+
+// relationKeys returns the keys in Packages which may hold packages named
+// by req. Packages of the native architecture are preferred, followed by
+// those of the declaring package's architecture. Native packages only
+// satisfy relations of foreign packages if they are Multi-Arch: foreign or
+// allowed, in which case the native package is the one which can run on
+// the machine, as with build tools when cross-building.
+func (p *PackageInfo) relationKeys(req deb.Requirement, parentArch string) []string {
+	native := p.Config.Arch.Arch
+	switch {
+	case req.ArchConstraint.Native:
+		return []string{req.Package}
+	case req.ArchConstraint.Arch != "" && !req.ArchConstraint.Any:
+		return []string{qualifiedName(native, req.Package, req.ArchConstraint.Arch)}
+	}
+
+	if parentArch == "" || parentArch == anyArch {
+		parentArch = native
+	}
+	keys := []string{req.Package}
+	if parentArch != native {
+		keys = append(keys, qualifiedName(native, req.Package, parentArch))
+	}
+	for _, arch := range p.archList() {
+		if arch == native || arch == parentArch {
+			continue
+		}
+		keys = append(keys, qualifiedName(native, req.Package, arch))
+	}
+	return keys
+}
+
+// relationCandidates returns the packages which satisfy req when declared
+// by a package of architecture parentArch, grouped by the key they are
+// stored under, in order of preference. Packages providing req are
+// returned last, in a single group.
+func (p *PackageInfo) relationCandidates(req deb.Requirement, parentArch string) ([][]*deb.Paragraph, error) {
+	native := p.Config.Arch.Arch
+	var out [][]*deb.Paragraph
+	for _, key := range p.relationKeys(req, parentArch) {
+		var group []*deb.Paragraph
+		for v, pkg := range p.Packages[key] {
+			if !archSatisfies(pkg, req, parentArch, native) {
+				continue
+			}
+			if req.VersionConstraint != nil {
+				ok, err := req.VersionConstraint.Satisfied(v)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+			}
+			group = append(group, pkg)
+		}
+		if len(group) > 0 {
+			out = append(out, group)
+		}
+	}
+
+	if req.VersionConstraint == nil {
+		var providers []*deb.Paragraph
+		for _, pkg := range p.virtualPackages[req.Package] {
+			if archSatisfies(pkg, req, parentArch, native) {
+				providers = append(providers, pkg)
+			}
+		}
+		if len(providers) > 0 {
+			out = append(out, providers)
+		}
+	}
+	return out, nil
+}
+
+// findRelation returns the candidate which should be installed to satisfy
+// req, when declared by a package of architecture parentArch. Packages are
+// preferred in the order given by relationKeys, and real packages are
+// preferred over those providing req. os.ErrNotExist is
+// returned if no package can satisfy req.
+func (p *PackageInfo) findRelation(req deb.Requirement, parentArch string) (*deb.Paragraph, error) {
+	groups, err := p.relationCandidates(req, parentArch)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		pkg, err := p.bestCandidate(group)
+		if err == os.ErrNotExist {
+			continue
+		}
+		return pkg, err
+	}
+	return nil, os.ErrNotExist
+}
+
+// hasRelation returns true if any package satisfies req, when declared by a
+// package of architecture parentArch. Priorities are not considered, and
+// packages which a dpkg status file describes as not installed are
+// ignored.
+func (p *PackageInfo) hasRelation(req deb.Requirement, parentArch string) (bool, error) {
+	if p == nil {
+		return false, nil
+	}
+	groups, err := p.relationCandidates(req, parentArch)
+	if err != nil {
+		return false, err
+	}
+	for _, group := range groups {
+		for _, pkg := range group {
+			if pkg.IsInstalled() {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,142 @@
+package debdep
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+// multiarchConfig is the configuration of a system which has added i386 as
+// a foreign architecture.
+var multiarchConfig = ResolverConfig{
+	Arch:          deb.Arch{Arch: "amd64"},
+	ForeignArches: []string{"i386"},
+}
+
+func TestMultiarchKeys(t *testing.T) {
+	pkgs := makeConfiguredPkgInfo(t, multiarchConfig,
+		map[string]string{"Package": "libc6", "Version": "2.28", "Architecture": "amd64", "Multi-Arch": "same"},
+		map[string]string{"Package": "libc6", "Version": "2.28", "Architecture": "i386", "Multi-Arch": "same"},
+		map[string]string{"Package": "docs", "Version": "1", "Architecture": "all"},
+	)
+
+	for _, name := range []string{"libc6", "libc6:i386", "docs"} {
+		if _, ok := pkgs.Packages[name]; !ok {
+			t.Errorf("Packages[%q] not present", name)
+		}
+	}
+	if got, want := pkgs.archList(), []string{"amd64", "i386"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("archList() = %v, want %v", got, want)
+	}
+}
+
+func TestInstallGraphMultiarch(t *testing.T) {
+	pkgs := makeConfiguredPkgInfo(t, multiarchConfig,
+		map[string]string{"Package": "libc6", "Version": "2.28", "Architecture": "amd64", "Multi-Arch": "same"},
+		map[string]string{"Package": "libc6", "Version": "2.28", "Architecture": "i386", "Multi-Arch": "same"},
+		map[string]string{"Package": "tool", "Version": "1", "Architecture": "amd64", "Multi-Arch": "foreign", "Depends": "libc6"},
+		map[string]string{"Package": "perl", "Version": "5.28", "Architecture": "amd64", "Multi-Arch": "allowed", "Depends": "libc6"},
+		map[string]string{"Package": "libonly", "Version": "1", "Architecture": "amd64"},
+		map[string]string{"Package": "app", "Version": "1", "Architecture": "i386", "Depends": "libc6, tool"},
+		map[string]string{"Package": "scripts", "Version": "1", "Architecture": "i386", "Depends": "perl:any"},
+		map[string]string{"Package": "noany", "Version": "1", "Architecture": "i386", "Depends": "perl"},
+		map[string]string{"Package": "nativedep", "Version": "1", "Architecture": "i386", "Depends": "libc6:native"},
+		map[string]string{"Package": "broken", "Version": "1", "Architecture": "i386", "Depends": "libonly"},
+	)
+
+	tcs := []struct {
+		name   string
+		target string
+		want   []string
+		err    bool
+	}{
+		{
+			name:   "same arch preferred",
+			target: "app:i386",
+			want:   []string{"libc6:i386", "libc6", "tool", "app:i386"},
+		},
+		{
+			name:   "native by default",
+			target: "tool",
+			want:   []string{"libc6", "tool"},
+		},
+		{
+			name:   "allowed with any",
+			target: "scripts:i386",
+			want:   []string{"libc6", "perl", "scripts:i386"},
+		},
+		{
+			name:   "allowed without any",
+			target: "noany:i386",
+			err:    true,
+		},
+		{
+			name:   "native qualifier",
+			target: "nativedep:i386",
+			want:   []string{"libc6", "nativedep:i386"},
+		},
+		{
+			name:   "not multiarch",
+			target: "broken:i386",
+			err:    true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			graph, err := pkgs.InstallGraph(tc.target, nil)
+			if tc.err {
+				if _, ok := err.(ErrDependency); !ok {
+					t.Fatalf("InstallGraph(%q) error = %v, want ErrDependency", tc.target, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstallGraph(%q) failed: %v", tc.target, err)
+			}
+
+			var got []string
+			for _, op := range graph.Unroll() {
+				got = append(got, op.Package)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("InstallGraph(%q) = %v, want %v", tc.target, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInstallGraphMultiarchInstalled(t *testing.T) {
+	pkgs := makeConfiguredPkgInfo(t, multiarchConfig,
+		map[string]string{"Package": "libc6", "Version": "2.28", "Architecture": "amd64", "Multi-Arch": "same"},
+		map[string]string{"Package": "libc6", "Version": "2.28", "Architecture": "i386", "Multi-Arch": "same"},
+		map[string]string{"Package": "app", "Version": "1", "Architecture": "amd64", "Depends": "libc6"},
+		map[string]string{"Package": "app", "Version": "1", "Architecture": "i386", "Depends": "libc6"},
+	)
+	installed := makeConfiguredPkgInfo(t, multiarchConfig,
+		map[string]string{"Package": "libc6", "Version": "2.28", "Architecture": "i386", "Multi-Arch": "same", "Status": "install ok installed"},
+	)
+
+	graph, err := pkgs.InstallGraphMulti([]string{"app:i386", "app"}, installed, ResolveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, op := range graph.Unroll() {
+		got = append(got, op.Package)
+	}
+	if want := []string{"app:i386", "libc6", "app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallGraphMulti() = %v, want %v", got, want)
+	}
+}
+
+func TestParseTargetSpecArch(t *testing.T) {
+	req, err := ParseTargetSpec("libc6:i386=2.28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Package != "libc6" || req.ArchConstraint.Arch != "i386" || req.VersionConstraint == nil || req.VersionConstraint.Version != "2.28" {
+		t.Errorf("ParseTargetSpec() = %+v, want libc6:i386 (= 2.28)", req)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/twitchyliquid64/debdep/deb"
@@ -23,6 +24,9 @@ type ResolverConfig struct {
 	Component    string
 	Arch         deb.Arch
 	BaseURL      string
+	// ForeignArches lists additional architectures which packages
+	// may be installed for, as with dpkg --add-architecture.
+	ForeignArches []string
 }
 
 var (
@@ -38,11 +42,10 @@ var (
 )
 
 func url(c ResolverConfig, isBinary bool) string {
-	src := "source-"
-	if isBinary {
-		src = "binary-"
+	if !isBinary {
+		return c.BaseURL + "/dists/" + c.Codename + "/" + c.Component + "/source"
 	}
-	return c.BaseURL + "/dists/" + c.Codename + "/" + c.Component + "/" + src + c.Arch.Arch
+	return c.BaseURL + "/dists/" + c.Codename + "/" + c.Component + "/binary-" + c.Arch.Arch
 }
 
 // ReleaseInconsistency is returned by CheckReleaseStatus if the settings for distribution/component/arch
@@ -136,13 +139,28 @@ type PackageInfo struct {
 	BinaryPackages  bool
 	Packages        map[string]map[version.Version]*deb.Paragraph
 	virtualPackages map[string][]*deb.Paragraph
+
+	// Release describes the suite the packages were loaded from, if known.
+	Release *Release
+	// Policy controls which version of a package is chosen for
+	// installation. If nil, the newest version is chosen.
+	Policy *Policy
+	// origins tracks the releases of packages which were merged in
+	// from other suites.
+	origins map[*deb.Paragraph][]*Release
+	// foreignArches tracks the foreign architectures of packages present.
+	foreignArches map[string]bool
 }
 
-// GetAllByPriority returns all packages with a given priority.
+// GetAllByPriority returns all packages of the native architecture with a
+// given priority, in sorted order.
 func (p *PackageInfo) GetAllByPriority(priority string) []string {
 	var out []string
-	for n, _ := range p.Packages {
-		latest, _ := p.FindLatest(n)
+	for _, n := range p.names() {
+		latest, err := p.FindCandidate(n)
+		if err != nil || n != latest.Name() {
+			continue // Unavailable, or of a foreign architecture.
+		}
 		if latest.Values["Priority"] == priority {
 			out = append(out, n)
 		}
@@ -150,11 +168,15 @@ func (p *PackageInfo) GetAllByPriority(priority string) []string {
 	return out
 }
 
-// GetAllEssential returns all packages marked as essential.
+// GetAllEssential returns all packages of the native architecture marked
+// as essential, in sorted order.
 func (p *PackageInfo) GetAllEssential() []string {
 	var out []string
-	for n, _ := range p.Packages {
-		latest, _ := p.FindLatest(n)
+	for _, n := range p.names() {
+		latest, err := p.FindCandidate(n)
+		if err != nil || n != latest.Name() {
+			continue // Unavailable, or of a foreign architecture.
+		}
 		if latest.Values["Essential"] == "yes" {
 			out = append(out, n)
 		}
@@ -162,40 +184,87 @@ func (p *PackageInfo) GetAllEssential() []string {
 	return out
 }
 
+// names returns the keys of Packages in sorted order.
+func (p *PackageInfo) names() []string {
+	out := make([]string, 0, len(p.Packages))
+	for n := range p.Packages {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// sortedVersions returns the versions of a package, oldest first.
+func sortedVersions(versions map[version.Version]*deb.Paragraph) []version.Version {
+	out := make([]version.Version, 0, len(versions))
+	for v := range versions {
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].LessThan(out[j])
+	})
+	return out
+}
+
 // HasPackage returns true if a package meeting the given requirements
 // is present. This includes virtual packages.
 func (p *PackageInfo) HasPackage(req deb.Requirement) (bool, error) {
 	if req.Kind != deb.PackageRelationRequirement {
 		return false, errors.New("only requirement.Kind == PackageRelationRequirement supported")
 	}
-	if _, exists := p.Packages[req.Package]; !exists {
-		if _, virtPkgExists := p.virtualPackages[req.Package]; virtPkgExists && req.VersionConstraint == nil {
-			return true, nil
-		}
-		return false, nil
-	}
-	if req.VersionConstraint == nil {
-		return true, nil
-	} else {
-		if _, err := p.FindWithVersionConstraint(req); err != nil {
-			if err == os.ErrNotExist {
-				return false, nil
-			}
-			return false, err
-		}
-	}
-	return true, nil
+	return p.hasRelation(req, "")
 }
 
 // AddPkg appends a package, overwriting any name+version combination that already exists.
 func (p *PackageInfo) AddPkg(pkg *deb.Paragraph) error {
-	if p.virtualPackages == nil {
-		p.virtualPackages = make(map[string][]*deb.Paragraph)
+	return p.appendPkg(pkg)
+}
+
+// QualifiedName returns the name under which a package of the given
+// architecture is stored in Packages. Packages of a foreign architecture
+// are qualified with their architecture, such as libc6:i386.
+func (p *PackageInfo) QualifiedName(name, arch string) string {
+	return qualifiedName(p.Config.Arch.Arch, name, arch)
+}
+
+// Merge adds the packages from other to p, such as when combining the
+// packages of several suites. Packages remember the release they were
+// loaded from, so the Policy can prefer some suites over others.
+func (p *PackageInfo) Merge(other *PackageInfo) error {
+	if p.origins == nil {
+		p.origins = make(map[*deb.Paragraph][]*Release)
 	}
-	if p.Packages == nil {
-		p.Packages = make(map[string]map[version.Version]*deb.Paragraph)
+	// A nil release is tracked for packages from an unknown suite, so
+	// they receive the default priority.
+	releases := func(info *PackageInfo, pkg *deb.Paragraph) []*Release {
+		if rels := info.releasesOf(pkg); len(rels) > 0 {
+			return rels
+		}
+		return []*Release{nil}
 	}
-	return pkgInfoAppend(pkg, p.Packages, p.virtualPackages)
+
+	// Packages are added in sorted order, so the order of providers of
+	// virtual packages does not depend on map iteration.
+	for _, n := range other.names() {
+		versions := other.Packages[n]
+		for _, v := range sortedVersions(versions) {
+			pkg := versions[v]
+			name := pkg.Name()
+			if p.BinaryPackages {
+				name = p.QualifiedName(pkg.Name(), pkg.Arch())
+			}
+			if existing, ok := p.Packages[name][v]; ok {
+				// The same version is available from several suites.
+				p.origins[existing] = append(releases(p, existing), releases(other, pkg)...)
+				continue
+			}
+			if err := p.appendPkg(pkg); err != nil {
+				return err
+			}
+			p.origins[pkg] = releases(other, pkg)
+		}
+	}
+	return nil
 }
 
 // FetchPath returns the URL to retrieve a package.
@@ -213,8 +282,12 @@ func (p *PackageInfo) FetchPath(pkg string, version version.Version) (string, er
 
 // readPackages consumes package info from the given reader.
 func readPackages(c ResolverConfig, r io.Reader, isBinaryPackages bool) (*PackageInfo, error) {
-	packages := make(map[string]map[version.Version]*deb.Paragraph)
-	virtualPackages := make(map[string][]*deb.Paragraph)
+	out := &PackageInfo{
+		Config:          c,
+		BinaryPackages:  isBinaryPackages,
+		Packages:        make(map[string]map[version.Version]*deb.Paragraph),
+		virtualPackages: make(map[string][]*deb.Paragraph),
+	}
 	d := deb.NewDecoder(r)
 
 	for {
@@ -227,30 +300,44 @@ func readPackages(c ResolverConfig, r io.Reader, isBinaryPackages bool) (*Packag
 			return nil, err
 		}
 
-		if err := pkgInfoAppend(&p, packages, virtualPackages); err != nil {
+		if err := out.appendPkg(&p); err != nil {
 			return nil, err
 		}
 	}
-	return &PackageInfo{
-		Config:          c,
-		BinaryPackages:  isBinaryPackages,
-		Packages:        packages,
-		virtualPackages: virtualPackages,
-	}, nil
+	return out, nil
 }
 
-func pkgInfoAppend(p *deb.Paragraph, packages map[string]map[version.Version]*deb.Paragraph, virtualPackages map[string][]*deb.Paragraph) error {
-	if _, ok := packages[p.Name()]; !ok {
-		packages[p.Name()] = make(map[version.Version]*deb.Paragraph)
+// appendPkg adds a package, keyed by its qualified name. Source packages
+// are keyed by name alone.
+func (p *PackageInfo) appendPkg(pkg *deb.Paragraph) error {
+	if p.virtualPackages == nil {
+		p.virtualPackages = make(map[string][]*deb.Paragraph)
 	}
-	vers, err := p.Version()
+	if p.Packages == nil {
+		p.Packages = make(map[string]map[version.Version]*deb.Paragraph)
+	}
+
+	name := pkg.Name()
+	if p.BinaryPackages {
+		name = p.QualifiedName(pkg.Name(), pkg.Arch())
+	}
+	if _, ok := p.Packages[name]; !ok {
+		p.Packages[name] = make(map[version.Version]*deb.Paragraph)
+	}
+	vers, err := pkg.Version()
 	if err != nil {
 		return err
 	}
-	packages[p.Name()][vers] = p
+	p.Packages[name][vers] = pkg
 
-	for _, virtualPackage := range p.Provides() {
-		virtualPackages[virtualPackage] = append(virtualPackages[virtualPackage], p)
+	if name != pkg.Name() {
+		if p.foreignArches == nil {
+			p.foreignArches = map[string]bool{}
+		}
+		p.foreignArches[pkg.Arch()] = true
+	}
+	for _, virtualPackage := range pkg.Provides() {
+		p.virtualPackages[virtualPackage] = append(p.virtualPackages[virtualPackage], pkg)
 	}
 	return nil
 }
@@ -267,9 +354,13 @@ func LoadPackageInfo(c ResolverConfig, path string, isBinaryPackages bool) (*Pac
 }
 
 // RepositoryPackagesReader returns a reader for package information from the
-// configured remote repository.
+// configured remote repository. If binary is false, the Sources index is read.
 func RepositoryPackagesReader(c ResolverConfig, binary bool) (io.ReadCloser, error) {
-	req, err := http.Get(url(c, binary) + "/Packages.gz")
+	index := "/Packages.gz"
+	if !binary {
+		index = "/Sources.gz"
+	}
+	req, err := http.Get(url(c, binary) + index)
 	if err != nil {
 		return nil, err
 	}
@@ -324,11 +415,31 @@ func RepositoryPackagesReader(c ResolverConfig, binary bool) (io.ReadCloser, err
 
 // Packages returns information about packages available in the
 // remote repository.
+//
+// If foreign architectures are configured, the binary packages of each
+// foreign architecture are included.
 func Packages(c ResolverConfig, binary bool) (*PackageInfo, error) {
 	r, err := RepositoryPackagesReader(c, binary)
 	if err != nil {
 		return nil, err
 	}
 	defer r.Close()
-	return readPackages(c, r, binary)
+	out, err := readPackages(c, r, binary)
+	if err != nil || !binary {
+		return out, err
+	}
+
+	for _, arch := range c.ForeignArches {
+		foreignConf := c
+		foreignConf.Arch.Arch = arch
+		foreignConf.ForeignArches = nil
+		foreign, err := Packages(foreignConf, binary)
+		if err != nil {
+			return nil, fmt.Errorf("arch %q: %v", arch, err)
+		}
+		if err := out.Merge(foreign); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
 }
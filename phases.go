@@ -0,0 +1,220 @@
+package debdep
+
+import (
+	"fmt"
+	"strings"
+)
+
+// installOps returns the package installs in graph, in the order of
+// graph.Unroll(), along with the index of each package.
+func installOps(graph *Operation) ([]Operation, map[string]int) {
+	var pkgs []Operation
+	index := map[string]int{}
+	for _, op := range graph.Unroll() {
+		if op.Kind != DebPackageInstallOp {
+			continue
+		}
+		if _, dupe := index[op.Package]; !dupe {
+			index[op.Package] = len(pkgs)
+			pkgs = append(pkgs, op)
+		}
+	}
+	return pkgs, index
+}
+
+// InstallPhases orders the packages in an install graph into unpack and
+// configure operations, forming a sequence which dpkg can perform:
+//
+//   - a package is unpacked before it is configured.
+//   - the Pre-Depends of a package are configured before it is unpacked.
+//   - the Depends of a package are configured before it is configured.
+//
+// Unpacks are performed as early as possible, so that runs of consecutive
+// operations of the same kind can be batched into a single dpkg invocation.
+// As dpkg does, packages in a loop of Depends are configured once all of
+// the packages in the loop are unpacked. An error is returned if the
+// Pre-Depends of packages form a loop.
+func (p *PackageInfo) InstallPhases(graph *Operation) ([]Operation, error) {
+	pkgs, index := installOps(graph)
+	edges, err := p.InstallEdges(graph)
+	if err != nil {
+		return nil, err
+	}
+
+	// Node 2*i is the unpack of pkgs[i], and node 2*i+1 its configure.
+	// Prerequisites from Depends may be ignored to break loops.
+	prereqs := make([][]int, 2*len(pkgs))
+	soft := make([][]int, 2*len(pkgs))
+	for i := range pkgs {
+		prereqs[2*i+1] = append(prereqs[2*i+1], 2*i)
+	}
+	for _, e := range edges {
+		from, to := index[e.From], index[e.To]
+		switch e.Field {
+		case "Pre-Depends":
+			prereqs[2*from] = append(prereqs[2*from], 2*to+1)
+		case "Depends":
+			soft[2*from+1] = append(soft[2*from+1], 2*to+1)
+		}
+	}
+
+	done := make([]bool, 2*len(pkgs))
+	ready := func(node int, breakLoops bool) bool {
+		for _, n := range prereqs[node] {
+			if !done[n] {
+				return false
+			}
+		}
+		for _, n := range soft[node] {
+			// When breaking a loop, a dependency only needs to be unpacked.
+			if !done[n] && (!breakLoops || !done[n-1]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	out := make([]Operation, 0, 2*len(pkgs))
+	emit := func(node int) {
+		done[node] = true
+		op := pkgs[node/2]
+		op.Kind = DebPackageUnpackOp
+		if node%2 == 1 {
+			op.Kind = DebPackageConfigureOp
+		}
+		out = append(out, op)
+	}
+
+	for len(out) < len(done) {
+		progress := false
+		// Perform every unpack which is possible, and only then configure.
+		for _, phase := range []int{0, 1} {
+			for i := range pkgs {
+				if node := 2*i + phase; !done[node] && ready(node, false) {
+					emit(node)
+					progress = true
+				}
+			}
+			if progress {
+				break
+			}
+		}
+		if progress {
+			continue
+		}
+
+		// Every remaining package is waiting on another: configure the
+		// first package whose dependencies are at least unpacked.
+		for i := range pkgs {
+			if node := 2*i + 1; !done[node] && ready(node, true) {
+				emit(node)
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			var stuck []string
+			for i := range pkgs {
+				if !done[2*i] {
+					stuck = append(stuck, pkgs[i].Package)
+				}
+			}
+			return nil, fmt.Errorf("cannot order installation: Pre-Depends loop between %s", strings.Join(stuck, ", "))
+		}
+	}
+	return out, nil
+}
+
+// InstallBatches groups the packages in an install graph into levels. The
+// dependencies of each package are satisfied by packages in earlier levels
+// (or are already installed), so the packages within a level are
+// independent of each other, and can be downloaded or unpacked
+// concurrently. Packages in a loop of dependencies share a level.
+//
+// Within each level, packages appear in the order of graph.Unroll().
+func (p *PackageInfo) InstallBatches(graph *Operation) ([][]Operation, error) {
+	pkgs, index := installOps(graph)
+	edges, err := p.InstallEdges(graph)
+	if err != nil {
+		return nil, err
+	}
+	deps := make([][]int, len(pkgs))
+	for _, e := range edges {
+		if e.Field == "Pre-Depends" || e.Field == "Depends" {
+			deps[index[e.From]] = append(deps[index[e.From]], index[e.To])
+		}
+	}
+
+	// Find the strongly connected components using Tarjan's algorithm.
+	// Components are completed in dependency order.
+	var (
+		order      = make([]int, len(pkgs))
+		low        = make([]int, len(pkgs))
+		onStack    = make([]bool, len(pkgs))
+		component  = make([]int, len(pkgs))
+		stack      []int
+		components [][]int
+		counter    = 1
+	)
+	var visit func(n int)
+	visit = func(n int) {
+		order[n], low[n] = counter, counter
+		counter++
+		stack = append(stack, n)
+		onStack[n] = true
+		for _, d := range deps[n] {
+			switch {
+			case order[d] == 0:
+				visit(d)
+				if low[d] < low[n] {
+					low[n] = low[d]
+				}
+			case onStack[d] && order[d] < low[n]:
+				low[n] = order[d]
+			}
+		}
+		if low[n] != order[n] {
+			return
+		}
+		var members []int
+		for {
+			m := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[m] = false
+			component[m] = len(components)
+			members = append(members, m)
+			if m == n {
+				break
+			}
+		}
+		components = append(components, members)
+	}
+	for n := range pkgs {
+		if order[n] == 0 {
+			visit(n)
+		}
+	}
+
+	// The level of a component is one more than its deepest dependency.
+	levels := make([]int, len(components))
+	maxLevel := -1
+	for c, members := range components {
+		for _, m := range members {
+			for _, d := range deps[m] {
+				if dc := component[d]; dc != c && levels[dc]+1 > levels[c] {
+					levels[c] = levels[dc] + 1
+				}
+			}
+		}
+		if levels[c] > maxLevel {
+			maxLevel = levels[c]
+		}
+	}
+
+	out := make([][]Operation, maxLevel+1)
+	for n, op := range pkgs {
+		l := levels[component[n]]
+		out[l] = append(out[l], op)
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package debdep
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInstallPhases(t *testing.T) {
+	pkgs := makePkgInfo(t,
+		map[string]string{"Package": "base", "Version": "1", "Pre-Depends": "pre", "Depends": "lib"},
+		map[string]string{"Package": "pre", "Version": "1"},
+		map[string]string{"Package": "lib", "Version": "1", "Depends": "cyc"},
+		map[string]string{"Package": "cyc", "Version": "1", "Depends": "lib"},
+	)
+	graph, err := pkgs.InstallGraph("base", &PackageInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	phases, err := pkgs.InstallPhases(graph)
+	if err != nil {
+		t.Fatalf("InstallPhases() failed: %v", err)
+	}
+
+	var got []string
+	for _, op := range phases {
+		got = append(got, op.Kind.String()+" "+op.Package)
+	}
+	want := []string{
+		"package-unpack pre",
+		"package-unpack cyc",
+		"package-unpack lib",
+		"package-configure pre",
+		"package-unpack base",
+		"package-configure cyc",
+		"package-configure lib",
+		"package-configure base",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallPhases() = %v, want %v", got, want)
+	}
+}
+
+func TestInstallPhasesPreDependsLoop(t *testing.T) {
+	pkgs := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "1", "Pre-Depends": "b"},
+		map[string]string{"Package": "b", "Version": "1", "Pre-Depends": "a"},
+	)
+	graph, err := pkgs.InstallGraph("a", &PackageInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pkgs.InstallPhases(graph); err == nil {
+		t.Error("InstallPhases() succeeded, want error for Pre-Depends loop")
+	}
+}
+
+func TestInstallBatches(t *testing.T) {
+	pkgs := makePkgInfo(t,
+		map[string]string{"Package": "base", "Version": "1", "Pre-Depends": "pre", "Depends": "lib, other"},
+		map[string]string{"Package": "pre", "Version": "1"},
+		map[string]string{"Package": "other", "Version": "1"},
+		map[string]string{"Package": "lib", "Version": "1", "Depends": "cyc"},
+		map[string]string{"Package": "cyc", "Version": "1", "Depends": "lib, leaf"},
+		map[string]string{"Package": "leaf", "Version": "1"},
+	)
+	graph, err := pkgs.InstallGraph("base", &PackageInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches, err := pkgs.InstallBatches(graph)
+	if err != nil {
+		t.Fatalf("InstallBatches() failed: %v", err)
+	}
+
+	var got [][]string
+	for _, batch := range batches {
+		var names []string
+		for _, op := range batch {
+			names = append(names, op.Package)
+		}
+		got = append(got, names)
+	}
+	want := [][]string{
+		{"pre", "leaf", "other"},
+		{"cyc", "lib"},
+		{"base"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallBatches() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,319 @@
+package debdep
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+// pkgSet is a set of concrete packages indexed by qualified name, such as
+// the set of packages installed on a system. It is used to reason about
+// relations between packages which are already chosen.
+type pkgSet struct {
+	pkgs      map[string]*deb.Paragraph
+	byName    map[string][]string
+	providers map[string][]string
+	native    string
+}
+
+func newPkgSet(native string) *pkgSet {
+	return &pkgSet{
+		pkgs:      map[string]*deb.Paragraph{},
+		byName:    map[string][]string{},
+		providers: map[string][]string{},
+		native:    native,
+	}
+}
+
+// installedSet returns the installed packages described by info. If several
+// versions of a package are present, the newest is used.
+func installedSet(info *PackageInfo) (*pkgSet, error) {
+	if info == nil {
+		return newPkgSet(""), nil
+	}
+	out := newPkgSet(info.Config.Arch.Arch)
+	for _, versions := range info.Packages {
+		var newest *deb.Paragraph
+		for v, pkg := range versions {
+			if !pkg.IsInstalled() {
+				continue
+			}
+			if newest != nil {
+				nv, err := newest.Version()
+				if err != nil {
+					return nil, err
+				}
+				if v.LessThan(nv) {
+					continue
+				}
+			}
+			newest = pkg
+		}
+		if newest != nil {
+			out.add(newest)
+		}
+	}
+	return out, nil
+}
+
+// key returns the name the package is stored under in the set.
+func (s *pkgSet) key(pkg *deb.Paragraph) string {
+	return qualifiedName(s.native, pkg.Name(), pkg.Arch())
+}
+
+// add inserts a package into the set, replacing any package with the
+// same name and architecture.
+func (s *pkgSet) add(pkg *deb.Paragraph) {
+	key := s.key(pkg)
+	if _, replacing := s.pkgs[key]; !replacing {
+		s.byName[pkg.Name()] = append(s.byName[pkg.Name()], key)
+	}
+	s.pkgs[key] = pkg
+	for _, provides := range pkg.Provides() {
+		s.providers[provides] = append(s.providers[provides], key)
+	}
+}
+
+// remove deletes the named package from the set. The indexes are left
+// alone, as lookups check the package is still present.
+func (s *pkgSet) remove(name string) {
+	delete(s.pkgs, name)
+}
+
+// names returns the names of all packages in the set, in sorted order.
+func (s *pkgSet) names() []string {
+	out := make([]string, 0, len(s.pkgs))
+	for n := range s.pkgs {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// satisfiers returns the sorted names of packages in the set which satisfy
+// req, which may be a package relation or a set of alternatives. parentArch
+// is the architecture of the package declaring the relation, or anyArch to
+// match packages of all architectures.
+func (s *pkgSet) satisfiers(req deb.Requirement, parentArch string) ([]string, error) {
+	found := map[string]bool{}
+	var walk func(r deb.Requirement) error
+	walk = func(r deb.Requirement) error {
+		switch r.Kind {
+		case deb.OrCompositeRequirement, deb.AndCompositeRequirement:
+			for _, c := range r.Children {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		candidates := append(append([]string{}, s.byName[r.Package]...), s.providers[r.Package]...)
+		for _, name := range candidates {
+			pkg, ok := s.pkgs[name]
+			if !ok || found[name] || !archSatisfies(pkg, r, parentArch, s.native) {
+				continue
+			}
+			ok, err := satisfiesRequirement(pkg, r)
+			if err != nil {
+				return err
+			}
+			if ok {
+				found[name] = true
+			}
+		}
+		return nil
+	}
+	if err := walk(req); err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(found))
+	for n := range found {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// satisfiesRequirement returns true if the package satisfies the given
+// package relation, either directly or through a virtual package it provides.
+func satisfiesRequirement(pkg *deb.Paragraph, req deb.Requirement) (bool, error) {
+	if req.Kind != deb.PackageRelationRequirement {
+		return false, fmt.Errorf("cannot check requirement type %v", req.Kind)
+	}
+	if pkg.Name() == req.Package {
+		if req.VersionConstraint == nil {
+			return true, nil
+		}
+		v, err := pkg.Version()
+		if err != nil {
+			return false, err
+		}
+		return req.VersionConstraint.Satisfied(v)
+	}
+	if req.VersionConstraint != nil {
+		return false, nil
+	}
+	for _, p := range pkg.Provides() {
+		if p == req.Package {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// unsatisfied returns the groups of the given relation field of pkg which
+// are not satisfied by any package in the set.
+func (s *pkgSet) unsatisfied(pkg *deb.Paragraph, field string) ([]deb.Requirement, error) {
+	spec, ok := pkg.Values[field]
+	if !ok {
+		return nil, nil
+	}
+	rel, err := deb.ParsePackageRelations(spec, pkg.Arch())
+	if err != nil {
+		return nil, err
+	}
+
+	var out []deb.Requirement
+	for _, group := range relationGroups(rel) {
+		if group.Kind == deb.AndCompositeRequirement && len(group.Children) == 0 {
+			continue
+		}
+		matches, err := s.satisfiers(group, effectiveArch(pkg, s.native))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			out = append(out, group)
+		}
+	}
+	return out, nil
+}
+
+// negativeRelation describes a package in a set which is named by a
+// Breaks or Conflicts relation of another package in the set.
+type negativeRelation struct {
+	Package  string
+	Field    string
+	Relation deb.Requirement
+	Victim   string
+}
+
+// violations returns the packages in the set which are broken by, or
+// conflict with, pkg. A package never conflicts with itself, or with
+// instances of itself of other architectures.
+func (s *pkgSet) violations(pkg *deb.Paragraph) ([]negativeRelation, error) {
+	var out []negativeRelation
+	for _, field := range []string{"Breaks", "Conflicts"} {
+		spec, ok := pkg.Values[field]
+		if !ok {
+			continue
+		}
+		rel, err := deb.ParsePackageRelations(spec, pkg.Arch())
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range relationGroups(rel) {
+			if group.Kind == deb.AndCompositeRequirement && len(group.Children) == 0 {
+				continue
+			}
+			matches, err := s.satisfiers(group, anyArch)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range matches {
+				if s.pkgs[m].Name() == pkg.Name() {
+					continue
+				}
+				out = append(out, negativeRelation{
+					Package:  s.key(pkg),
+					Field:    field,
+					Relation: group,
+					Victim:   m,
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+// brokenPackage describes a package in a set whose dependencies are not
+// satisfied by the set.
+type brokenPackage struct {
+	Package string
+	Field   string
+	Missing []deb.Requirement
+}
+
+// String describes the unsatisfied relations.
+func (b brokenPackage) String() string {
+	missing := make([]string, len(b.Missing))
+	for i, m := range b.Missing {
+		missing[i] = m.String()
+	}
+	return b.Package + " " + b.Field + ": " + strings.Join(missing, ", ")
+}
+
+// broken returns the packages in the set whose Depends or Pre-Depends
+// are not satisfied, in sorted order.
+func (s *pkgSet) broken() ([]brokenPackage, error) {
+	var out []brokenPackage
+	for _, name := range s.names() {
+		for _, field := range []string{"Pre-Depends", "Depends"} {
+			missing, err := s.unsatisfied(s.pkgs[name], field)
+			if err != nil {
+				return nil, err
+			}
+			if len(missing) > 0 {
+				out = append(out, brokenPackage{Package: name, Field: field, Missing: missing})
+			}
+		}
+	}
+	return out, nil
+}
+
+// removeBroken repeatedly removes packages from the set whose dependencies
+// are not satisfied, until none remain. Packages named in ignore are left
+// in the set even if broken. The removed packages are returned in the order
+// they were removed.
+func (s *pkgSet) removeBroken(ignore map[string]bool) ([]brokenPackage, error) {
+	var out []brokenPackage
+	for {
+		broken, err := s.broken()
+		if err != nil {
+			return nil, err
+		}
+		progress := false
+		for _, b := range broken {
+			if ignore[b.Package] {
+				continue
+			}
+			if _, present := s.pkgs[b.Package]; !present {
+				continue // Broken in more than one field.
+			}
+			progress = true
+			out = append(out, b)
+			s.remove(b.Package)
+		}
+		if !progress {
+			return out, nil
+		}
+	}
+}
+
+// alreadyBroken returns the names of packages in the set whose
+// dependencies are not satisfied.
+func (s *pkgSet) alreadyBroken() (map[string]bool, error) {
+	broken, err := s.broken()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(broken))
+	for _, b := range broken {
+		out[b.Package] = true
+	}
+	return out, nil
+}
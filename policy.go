@@ -0,0 +1,391 @@
+package debdep
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+// Default priorities assigned to package versions, as used by apt.
+const (
+	TargetReleasePriority        = 990
+	DefaultPriority              = 500
+	ButAutomaticUpgradesPriority = 100
+	InstalledPriority            = 100
+	NotAutomaticPriority         = 1
+)
+
+// Release describes a suite of a repository, as described in its Release file.
+type Release struct {
+	Origin   string
+	Label    string
+	Suite    string
+	Codename string
+	Version  string
+
+	// Host is the hostname of the repository, and Component the component
+	// packages were loaded from. These are not part of the Release file.
+	Host      string
+	Component string
+
+	NotAutomatic         bool
+	ButAutomaticUpgrades bool
+}
+
+// ReadRelease parses the contents of a Release file.
+func ReadRelease(r io.Reader) (*Release, error) {
+	var p deb.Paragraph
+	// Release files are not terminated by a blank line, so the paragraph
+	// may end at EOF.
+	if err := deb.NewDecoder(r).Decode(&p); err != nil && (err != io.EOF || len(p.Values) == 0) {
+		if err == io.EOF {
+			return nil, fmt.Errorf("empty release file")
+		}
+		return nil, err
+	}
+	return &Release{
+		Origin:               p.Values["Origin"],
+		Label:                p.Values["Label"],
+		Suite:                p.Values["Suite"],
+		Codename:             p.Values["Codename"],
+		Version:              p.Values["Version"],
+		NotAutomatic:         p.Values["NotAutomatic"] == "yes",
+		ButAutomaticUpgrades: p.Values["ButAutomaticUpgrades"] == "yes",
+	}, nil
+}
+
+// LoadRelease reads a Release file from disk. The file is taken to describe
+// the configured repository and component, which origin pins and c= release
+// pins are matched against.
+func LoadRelease(c ResolverConfig, path string) (*Release, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rel, err := ReadRelease(f)
+	if err != nil {
+		return nil, err
+	}
+	c.setSource(rel)
+	return rel, nil
+}
+
+// FetchRelease retrieves the Release file of the configured suite from the
+// remote repository.
+func FetchRelease(c ResolverConfig) (*Release, error) {
+	resp, err := http.Get(c.BaseURL + "/dists/" + c.Codename + "/Release")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching release: unexpected response code '%d' (%s)", resp.StatusCode, resp.Status)
+	}
+
+	rel, err := ReadRelease(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.setSource(rel)
+	return rel, nil
+}
+
+// setSource records the repository host and component of the configuration
+// in rel.
+func (c ResolverConfig) setSource(rel *Release) {
+	if u, err := neturl.Parse(c.BaseURL); err == nil {
+		rel.Host = u.Hostname()
+	}
+	rel.Component = c.Component
+}
+
+// PinRule describes an entry in an apt preferences file, which sets the
+// priority of matching package versions.
+type PinRule struct {
+	// Package is a space-separated list of package names, which may
+	// be glob patterns, or regular expressions delimited by slashes.
+	Package  string
+	Pin      string
+	Priority int
+}
+
+// specific returns true if the rule names packages explicitly, rather than
+// by pattern. Specific rules take precedence over general rules.
+func (r PinRule) specific() bool {
+	return !strings.ContainsAny(r.Package, "*?[/")
+}
+
+func (r PinRule) matchesName(name string) bool {
+	for _, pattern := range strings.Fields(r.Package) {
+		if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			if re, err := regexp.Compile(pattern[1 : len(pattern)-1]); err == nil && re.MatchString(name) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesVersion returns true if the pin applies to the given package,
+// which is available from the given release.
+func (r PinRule) matchesVersion(pkg *deb.Paragraph, rel *Release) bool {
+	kind := r.Pin
+	arg := ""
+	if idx := strings.Index(r.Pin, " "); idx != -1 {
+		kind, arg = r.Pin[:idx], strings.TrimSpace(r.Pin[idx+1:])
+	}
+
+	switch kind {
+	case "version":
+		ok, _ := path.Match(arg, pkg.Values["Version"])
+		return ok
+	case "origin":
+		return rel != nil && arg == rel.Host
+	case "release":
+		if rel == nil {
+			return false
+		}
+		for _, term := range strings.Split(arg, ",") {
+			term = strings.TrimSpace(term)
+			key, val := "a", term
+			if idx := strings.Index(term, "="); idx != -1 {
+				key, val = term[:idx], term[idx+1:]
+			}
+			var got string
+			switch key {
+			case "a":
+				got = rel.Suite
+			case "n":
+				got = rel.Codename
+			case "v":
+				got = rel.Version
+			case "o":
+				got = rel.Origin
+			case "l":
+				got = rel.Label
+			case "c":
+				got = rel.Component
+			case "b":
+				got = pkg.Arch()
+			default:
+				return false
+			}
+			if ok, _ := path.Match(val, got); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// ReadPreferences parses an apt preferences file.
+func ReadPreferences(r io.Reader) ([]PinRule, error) {
+	// Comments are not understood by the decoder, so are removed first.
+	var buf bytes.Buffer
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if strings.HasPrefix(strings.TrimSpace(s.Text()), "#") {
+			continue
+		}
+		buf.WriteString(s.Text() + "\n")
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+
+	var out []PinRule
+	d := deb.NewDecoder(&buf)
+	for {
+		var p deb.Paragraph
+		if err := d.Decode(&p); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		prio, err := strconv.Atoi(strings.TrimSpace(p.Values["Pin-Priority"]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Pin-Priority for %q: %v", p.Values["Package"], err)
+		}
+		out = append(out, PinRule{
+			Package:  strings.TrimSpace(p.Values["Package"]),
+			Pin:      strings.TrimSpace(p.Values["Pin"]),
+			Priority: prio,
+		})
+	}
+	return out, nil
+}
+
+// LoadPreferences reads an apt preferences file from disk.
+func LoadPreferences(path string) ([]PinRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPreferences(f)
+}
+
+// Policy describes how candidate versions are chosen when several are
+// available, such as from different suites.
+type Policy struct {
+	Pins []PinRule
+	// TargetRelease is the suite or codename whose packages are
+	// preferred, as with apt's --target-release.
+	TargetRelease string
+}
+
+// releasePriority returns the priority of packages from a release when no
+// pin applies.
+func (pol *Policy) releasePriority(rel *Release) int {
+	if rel == nil {
+		return DefaultPriority
+	}
+	if pol != nil && pol.TargetRelease != "" && (pol.TargetRelease == rel.Suite || pol.TargetRelease == rel.Codename) {
+		return TargetReleasePriority
+	}
+	switch {
+	case rel.NotAutomatic && rel.ButAutomaticUpgrades:
+		return ButAutomaticUpgradesPriority
+	case rel.NotAutomatic:
+		return NotAutomaticPriority
+	}
+	return DefaultPriority
+}
+
+func (pol *Policy) priority(pkg *deb.Paragraph, releases []*Release) int {
+	if len(releases) == 0 {
+		releases = []*Release{nil}
+	}
+
+	if pol != nil {
+		// Pins naming the package take precedence over general pins, and
+		// within each group the first matching pin applies.
+		for _, specific := range []bool{true, false} {
+			best, matched := 0, false
+			for _, rule := range pol.Pins {
+				if rule.specific() != specific || !rule.matchesName(pkg.Name()) {
+					continue
+				}
+				for _, rel := range releases {
+					if rule.matchesVersion(pkg, rel) && (!matched || rule.Priority > best) {
+						best, matched = rule.Priority, true
+					}
+				}
+				if matched {
+					return best
+				}
+			}
+		}
+	}
+
+	best := pol.releasePriority(releases[0])
+	for _, rel := range releases[1:] {
+		if p := pol.releasePriority(rel); p > best {
+			best = p
+		}
+	}
+	return best
+}
+
+// Priority returns the priority of the given package version, based on the
+// release(s) it is available from and the configured Policy. Versions with
+// negative priority are never chosen.
+func (p *PackageInfo) Priority(pkg *deb.Paragraph) int {
+	return p.Policy.priority(pkg, p.releasesOf(pkg))
+}
+
+func (p *PackageInfo) releasesOf(pkg *deb.Paragraph) []*Release {
+	if rels, ok := p.origins[pkg]; ok {
+		return rels
+	}
+	if p.Release != nil {
+		return []*Release{p.Release}
+	}
+	return nil
+}
+
+// bestCandidate returns the package with the highest priority, preferring
+// the newest version amongst those with equal priority. Remaining ties are
+// broken by package name and architecture, so the result does not depend on
+// the order of pkgs. os.ErrNotExist is returned if no package has a
+// non-negative priority.
+func (p *PackageInfo) bestCandidate(pkgs []*deb.Paragraph) (*deb.Paragraph, error) {
+	type candidate struct {
+		pkg      *deb.Paragraph
+		priority int
+	}
+	var candidates []candidate
+	for _, pkg := range pkgs {
+		if prio := p.Priority(pkg); prio >= 0 {
+			candidates = append(candidates, candidate{pkg, prio})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	var sortErr error
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority > candidates[j].priority
+		}
+		vi, err := candidates[i].pkg.Version()
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		vj, err := candidates[j].pkg.Version()
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		if !vi.Equal(vj) {
+			return vi.GreaterThan(vj)
+		}
+		// Distinct packages of the same version, such as providers of a
+		// virtual package, are ordered by name and architecture.
+		if ni, nj := candidates[i].pkg.Name(), candidates[j].pkg.Name(); ni != nj {
+			return ni < nj
+		}
+		return candidates[i].pkg.Arch() < candidates[j].pkg.Arch()
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+	return candidates[0].pkg, nil
+}
+
+// FindCandidate returns the version of the named package which should be
+// installed: the version with the highest priority, or if several share the
+// highest priority, the newest of those.
+func (p *PackageInfo) FindCandidate(target string) (*deb.Paragraph, error) {
+	pkgs, err := p.FindAll(target)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*deb.Paragraph, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		list = append(list, pkg)
+	}
+	return p.bestCandidate(list)
+}
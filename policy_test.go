@@ -0,0 +1,163 @@
+package debdep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadPreferences(t *testing.T) {
+	pins, err := ReadPreferences(strings.NewReader(`# Prefer our own build of foo.
+Package: foo
+Pin: version 2.*
+Pin-Priority: 1001
+
+Explanation: never install from experimental
+Package: *
+Pin: release a=experimental
+Pin-Priority: -1
+`))
+	if err != nil {
+		t.Fatalf("ReadPreferences() returned err: %v", err)
+	}
+	if len(pins) != 2 {
+		t.Fatalf("Expected 2 pins, got %+v", pins)
+	}
+	if pins[0] != (PinRule{Package: "foo", Pin: "version 2.*", Priority: 1001}) {
+		t.Errorf("First pin incorrect, got %+v", pins[0])
+	}
+	if pins[1] != (PinRule{Package: "*", Pin: "release a=experimental", Priority: -1}) {
+		t.Errorf("Second pin incorrect, got %+v", pins[1])
+	}
+}
+
+func makeSuites(t *testing.T) *PackageInfo {
+	t.Helper()
+	stable := makePkgInfo(t,
+		map[string]string{"Package": "base", "Version": "1.0", "Depends": "kek"},
+		map[string]string{"Package": "kek", "Version": "1.0"},
+	)
+	stable.Release = &Release{Suite: "stable", Codename: "buster"}
+	backports := makePkgInfo(t,
+		map[string]string{"Package": "base", "Version": "1.5", "Depends": "kek (>= 1.5)"},
+		map[string]string{"Package": "kek", "Version": "1.5"},
+	)
+	backports.Release = &Release{Suite: "buster-backports", Codename: "buster-backports", NotAutomatic: true, ButAutomaticUpgrades: true}
+	experimental := makePkgInfo(t,
+		map[string]string{"Package": "base", "Version": "2.0"},
+		map[string]string{"Package": "kek", "Version": "2.0"},
+	)
+	experimental.Release = &Release{Suite: "experimental", Codename: "rc-buggy", NotAutomatic: true}
+
+	if err := stable.Merge(backports); err != nil {
+		t.Fatal(err)
+	}
+	if err := stable.Merge(experimental); err != nil {
+		t.Fatal(err)
+	}
+	return stable
+}
+
+func TestFindCandidate(t *testing.T) {
+	tcs := []struct {
+		name   string
+		policy *Policy
+		want   string
+	}{
+		{
+			name: "default",
+			want: "1.0",
+		},
+		{
+			name:   "target release",
+			policy: &Policy{TargetRelease: "buster-backports"},
+			want:   "1.5",
+		},
+		{
+			name:   "pinned release",
+			policy: &Policy{Pins: []PinRule{{Package: "base", Pin: "release n=rc-buggy", Priority: 600}}},
+			want:   "2.0",
+		},
+		{
+			name: "negative priority",
+			policy: &Policy{Pins: []PinRule{
+				{Package: "*", Pin: "release a=stable", Priority: -1},
+			}},
+			want: "1.5",
+		},
+		{
+			name: "specific pin before general",
+			policy: &Policy{Pins: []PinRule{
+				{Package: "b*", Pin: "version 1.5", Priority: 50},
+				{Package: "b*", Pin: "release a=experimental", Priority: 700},
+				{Package: "base", Pin: "version 1.5", Priority: 800},
+			}},
+			want: "1.5",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			pkgs := makeSuites(t)
+			pkgs.Policy = tc.policy
+			pkg, err := pkgs.FindCandidate("base")
+			if err != nil {
+				t.Fatalf("FindCandidate() returned err: %v", err)
+			}
+			if got := pkg.Values["Version"]; got != tc.want {
+				t.Errorf("FindCandidate() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInstallGraphTargetRelease(t *testing.T) {
+	pkgs := makeSuites(t)
+	pkgs.Policy = &Policy{TargetRelease: "buster-backports"}
+
+	graph, err := pkgs.InstallGraph("base", &PackageInfo{})
+	if err != nil {
+		t.Fatalf("InstallGraph() returned err: %v", err)
+	}
+	var got []string
+	for _, op := range graph.Unroll() {
+		got = append(got, op.Package+"="+op.Version.String())
+	}
+	if want := "kek=1.5 base=1.5"; strings.Join(got, " ") != want {
+		t.Errorf("Unroll() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadRelease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debdep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "Release")
+	if err := ioutil.WriteFile(path, []byte("Origin: Debian\nSuite: stable\nCodename: buster\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := DefaultResolverConfig
+	conf.BaseURL = "http://deb.example.org/debian"
+	conf.Component = "contrib"
+	rel, err := LoadRelease(conf, path)
+	if err != nil {
+		t.Fatalf("LoadRelease() returned err: %v", err)
+	}
+	if rel.Host != "deb.example.org" || rel.Component != "contrib" {
+		t.Errorf("LoadRelease() = %+v, want host deb.example.org and component contrib", rel)
+	}
+
+	pkgs := makePkgInfo(t, map[string]string{"Package": "base", "Version": "1.0"})
+	for _, pkg := range pkgs.Packages["base"] {
+		for _, pin := range []string{"origin deb.example.org", "release o=Debian, c=contrib"} {
+			if !(PinRule{Package: "base", Pin: pin}).matchesVersion(pkg, rel) {
+				t.Errorf("Pin %q does not match the loaded release", pin)
+			}
+		}
+	}
+}
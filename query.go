@@ -0,0 +1,357 @@
+package debdep
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/twitchyliquid64/debdep/deb"
+
+	version "github.com/knqyf263/go-deb-version"
+)
+
+// Query selects packages by the values of their fields, similar to
+// grep-dctrl. Queries are built from terms, combined with AND, OR, NOT and
+// parentheses. NOT binds tightest, followed by AND. Each term names a field
+// and tests its value:
+//
+//	Field:regexp    the value matches the regular expression
+//	Field=value     the value is exactly value
+//	Field<value     also <=, > and >=, the value compares numerically if
+//	                both sides are integers, and as Debian versions otherwise
+//	Field~regexp    the field is a relation, such as Depends, naming a
+//	                package which matches the regular expression
+//
+// For example, "Section:libs AND Installed-Size>5000 AND NOT Depends~libx11".
+// Values containing spaces or parentheses may be double-quoted. Field names
+// and the keywords are not case sensitive. Terms naming a field the package
+// does not have are false.
+type Query struct {
+	expr string
+	root queryNode
+}
+
+// queryNode is a node of a parsed query.
+type queryNode interface {
+	match(pkg *deb.Paragraph) bool
+}
+
+type queryAnd []queryNode
+
+func (q queryAnd) match(pkg *deb.Paragraph) bool {
+	for _, n := range q {
+		if !n.match(pkg) {
+			return false
+		}
+	}
+	return true
+}
+
+type queryOr []queryNode
+
+func (q queryOr) match(pkg *deb.Paragraph) bool {
+	for _, n := range q {
+		if n.match(pkg) {
+			return true
+		}
+	}
+	return false
+}
+
+type queryNot struct {
+	node queryNode
+}
+
+func (q queryNot) match(pkg *deb.Paragraph) bool {
+	return !q.node.match(pkg)
+}
+
+// queryTerm tests the value of a single field.
+type queryTerm struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (q *queryTerm) match(pkg *deb.Paragraph) bool {
+	value, ok := fieldValue(pkg, q.field)
+	if !ok {
+		return false
+	}
+	switch q.op {
+	case ":":
+		return q.re.MatchString(value)
+	case "=":
+		return value == q.value
+	case "~":
+		rel, err := deb.ParsePackageRelations(value, pkg.Arch())
+		if err != nil {
+			return false
+		}
+		return relationNames(rel, q.re)
+	}
+
+	cmp, ok := compareValues(value, q.value)
+	if !ok {
+		return false
+	}
+	switch q.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default: // ">="
+		return cmp >= 0
+	}
+}
+
+// fieldValue returns the value of the named field of pkg. Field names are
+// not case sensitive.
+func fieldValue(pkg *deb.Paragraph, field string) (string, bool) {
+	if v, ok := pkg.Values[field]; ok {
+		return strings.TrimSpace(v), true
+	}
+	for k, v := range pkg.Values {
+		if strings.EqualFold(k, field) {
+			return strings.TrimSpace(v), true
+		}
+	}
+	return "", false
+}
+
+// compareValues compares a field value against the value in a query,
+// numerically if both are integers, and as Debian versions otherwise. The
+// second return value is false if the values cannot be compared.
+func compareValues(value, want string) (int, bool) {
+	if w, err := strconv.ParseInt(want, 10, 64); err == nil {
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case v < w:
+			return -1, true
+		case v > w:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	v, err := version.NewVersion(value)
+	if err != nil {
+		return 0, false
+	}
+	w, err := version.NewVersion(want)
+	if err != nil {
+		return 0, false
+	}
+	return v.Compare(w), true
+}
+
+// relationNames returns true if any relation in req names a package
+// matching the regular expression.
+func relationNames(req deb.Requirement, re *regexp.Regexp) bool {
+	if req.Kind == deb.PackageRelationRequirement {
+		return re.MatchString(req.Package)
+	}
+	for _, c := range req.Children {
+		if relationNames(c, re) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseQuery parses a query. See Query for the syntax.
+func ParseQuery(expr string) (*Query, error) {
+	tokens, err := tokenizeQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in query", p.tokens[p.pos])
+	}
+	return &Query{expr: expr, root: root}, nil
+}
+
+// String returns the query as it was parsed.
+func (q *Query) String() string {
+	return q.expr
+}
+
+// Match returns true if the package is selected by the query.
+func (q *Query) Match(pkg *deb.Paragraph) bool {
+	return q.root.match(pkg)
+}
+
+// GetAllMatching returns all packages of the native architecture whose
+// candidate version is selected by the query, in sorted order.
+func (p *PackageInfo) GetAllMatching(q *Query) []string {
+	var out []string
+	for _, n := range p.names() {
+		latest, err := p.FindCandidate(n)
+		if err != nil || n != latest.Name() {
+			continue // Unavailable, or of a foreign architecture.
+		}
+		if q.Match(latest) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// tokenizeQuery splits a query into parentheses, keywords and terms.
+// Quotes are kept in terms, to be removed by parseTerm.
+func tokenizeQuery(expr string) ([]string, error) {
+	var (
+		out    []string
+		cur    strings.Builder
+		quoted bool
+	)
+	flush := func() {
+		if cur.Len() > 0 {
+			out = append(out, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, c := range expr {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			cur.WriteRune(c)
+		case quoted:
+			cur.WriteRune(c)
+		case c == '(' || c == ')':
+			flush()
+			out = append(out, string(c))
+		case unicode.IsSpace(c):
+			flush()
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in query %q", expr)
+	}
+	flush()
+	return out, nil
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+// accept consumes the next token if it is the given keyword or
+// parenthesis.
+func (p *queryParser) accept(keyword string) bool {
+	if p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos], keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	var out queryOr
+	for {
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+		if !p.accept("OR") {
+			break
+		}
+	}
+	if len(out) == 1 {
+		return out[0], nil
+	}
+	return out, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var out queryAnd
+	for {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+		if !p.accept("AND") {
+			break
+		}
+	}
+	if len(out) == 1 {
+		return out[0], nil
+	}
+	return out, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if p.accept("NOT") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{node: n}, nil
+	}
+	if p.accept("(") {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing ')' in query")
+		}
+		return n, nil
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	return parseTerm(tok)
+}
+
+// queryOperators are the operators which may follow a field name. Longer
+// operators are listed first, so that <= is not mistaken for <.
+var queryOperators = []string{"<=", ">=", ":", "=", "<", ">", "~"}
+
+// parseTerm parses a term such as Section:libs.
+func parseTerm(tok string) (queryNode, error) {
+	idx := strings.IndexAny(tok, ":=<>~")
+	if idx <= 0 {
+		return nil, fmt.Errorf("invalid query term %q, want a field, operator and value", tok)
+	}
+	out := &queryTerm{field: tok[:idx]}
+	for _, op := range queryOperators {
+		if strings.HasPrefix(tok[idx:], op) {
+			out.op = op
+			break
+		}
+	}
+	out.value = tok[idx+len(out.op):]
+	if len(out.value) >= 2 && strings.HasPrefix(out.value, `"`) && strings.HasSuffix(out.value, `"`) {
+		out.value = out.value[1 : len(out.value)-1]
+	}
+
+	if out.op == ":" || out.op == "~" {
+		re, err := regexp.Compile(out.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression in query term %q: %v", tok, err)
+		}
+		out.re = re
+	}
+	return out, nil
+}
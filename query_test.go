@@ -0,0 +1,92 @@
+package debdep
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+func TestQueryMatch(t *testing.T) {
+	pkg := &deb.Paragraph{Values: map[string]string{
+		"Package":        "libfoo1",
+		"Version":        "1.2-3",
+		"Section":        "libs",
+		"Installed-Size": "6000",
+		"Depends":        "libc6 (>= 2.28), libx11-6 | libwayland0",
+		"Description":    "foo library",
+	}}
+
+	tcs := []struct {
+		query string
+		want  bool
+	}{
+		{"Section:libs", true},
+		{"Section:^lib$", false},
+		{"section=libs", true},
+		{"Section=lib", false},
+		{"Installed-Size>5000", true},
+		{"Installed-Size<=5000", false},
+		{"Version>=1.2-1", true},
+		{"Version<1.2", false},
+		{"Depends~libc6", true},
+		{"Depends~libwayland0", true},
+		{"Depends~libc", true},
+		{"Depends~^libc$", false},
+		{"Depends~^libx11-6$", true},
+		{"Depends~gtk", false},
+		{"Section:libs AND Installed-Size>5000 AND NOT Depends~libx11", false},
+		{"Section:libs AND NOT Depends~libgtk", true},
+		{"Section:devel OR Package:^libfoo", true},
+		{"NOT (Section:devel OR Section:libs)", false},
+		{"Section:devel or Section:libs and not Priority:required", true},
+		{`Description:"foo lib"`, true},
+		{"Priority:.", false},
+		{"NOT Priority:.", true},
+		{"Installed-Size>abc", false},
+	}
+	for _, tc := range tcs {
+		q, err := ParseQuery(tc.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned err: %v", tc.query, err)
+			continue
+		}
+		if got := q.Match(pkg); got != tc.want {
+			t.Errorf("ParseQuery(%q).Match() = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"Section",
+		"Section:libs AND",
+		"(Section:libs",
+		"Section:libs)",
+		"Section:[",
+		"Depends~[",
+		`Description:"foo`,
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) succeeded, want error", query)
+		}
+	}
+}
+
+func TestGetAllMatching(t *testing.T) {
+	pkgs := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "1", "Section": "libs"},
+		map[string]string{"Package": "a", "Version": "2", "Section": "oldlibs"},
+		map[string]string{"Package": "b", "Version": "1", "Section": "libs"},
+		map[string]string{"Package": "c", "Version": "1", "Section": "admin"},
+	)
+	q, err := ParseQuery("Section:^libs$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the candidate version of each package is considered.
+	if got, want := pkgs.GetAllMatching(q), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAllMatching(%v) = %v, want %v", q, got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package debdep
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+// autoremoveFields are the relations which keep a package from being
+// automatically removed. As with apt's defaults, recommendations and
+// suggestions are considered important.
+var autoremoveFields = []string{"Pre-Depends", "Depends", "Recommends", "Suggests"}
+
+// RemovalImpact returns the installed packages which would become broken
+// if the named package were removed, including those broken by the removal
+// of other broken packages. The receiver describes the installed packages.
+// Packages which are already broken are not reported.
+func (p *PackageInfo) RemovalImpact(pkg string) ([]Removal, error) {
+	installed, err := installedSet(p)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := installed.pkgs[pkg]; !ok {
+		return nil, fmt.Errorf("package %q is not installed", pkg)
+	}
+	ignore, err := installed.alreadyBroken()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]*deb.Paragraph, len(installed.pkgs))
+	for n, p := range installed.pkgs {
+		versions[n] = p
+	}
+	installed.remove(pkg)
+	broken, err := installed.removeBroken(ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Removal, len(broken))
+	for i, b := range broken {
+		v, err := versions[b.Package].Version()
+		if err != nil {
+			return nil, err
+		}
+		out[i] = Removal{Package: b.Package, Version: v, Reason: b.String()}
+	}
+	return out, nil
+}
+
+// Autoremovable returns the installed packages which were automatically
+// installed, and are no longer required by any manually installed package,
+// similar to apt autoremove. The receiver describes the installed packages,
+// and autoInstalled the packages which were automatically installed.
+//
+// Essential packages are never removed. Recommendations and suggestions
+// of a required package keep the satisfying packages installed.
+func (p *PackageInfo) Autoremovable(autoInstalled map[string]bool) ([]Removal, error) {
+	installed, err := installedSet(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mark everything reachable from manually installed packages.
+	required := map[string]bool{}
+	var queue []string
+	for _, name := range installed.names() {
+		if !autoInstalled[name] || installed.pkgs[name].Values["Essential"] == "yes" {
+			required[name] = true
+			queue = append(queue, name)
+		}
+	}
+	for len(queue) > 0 {
+		pkg := installed.pkgs[queue[0]]
+		queue = queue[1:]
+
+		for _, field := range autoremoveFields {
+			spec, ok := pkg.Values[field]
+			if !ok {
+				continue
+			}
+			rel, err := deb.ParsePackageRelations(spec, pkg.Arch())
+			if err != nil {
+				return nil, err
+			}
+			matches, err := installed.satisfiers(rel, effectiveArch(pkg, installed.native))
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range matches {
+				if !required[m] {
+					required[m] = true
+					queue = append(queue, m)
+				}
+			}
+		}
+	}
+
+	var out []Removal
+	for _, name := range installed.names() {
+		if required[name] {
+			continue
+		}
+		v, err := installed.pkgs[name].Version()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Removal{
+			Package: name,
+			Version: v,
+			Reason:  "automatically installed and no longer required",
+		})
+	}
+	return out, nil
+}
+
+// ReadExtendedStates parses an apt extended_states file, returning the
+// names of packages which were automatically installed. As in
+// PackageInfo.Packages, packages of an architecture other than native are
+// qualified with their architecture, such as libc6:i386.
+func ReadExtendedStates(r io.Reader, native string) (map[string]bool, error) {
+	out := map[string]bool{}
+	d := deb.NewDecoder(r)
+	for {
+		var p deb.Paragraph
+		if err := d.Decode(&p); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if strings.TrimSpace(p.Values["Auto-Installed"]) == "1" {
+			out[qualifiedName(native, p.Name(), p.Arch())] = true
+		}
+	}
+	return out, nil
+}
+
+// LoadExtendedStates reads an apt extended_states file from disk. This is
+// typically /var/lib/apt/extended_states.
+func LoadExtendedStates(path, native string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadExtendedStates(f, native)
+}
@@ -0,0 +1,141 @@
+package debdep
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRemovalImpact(t *testing.T) {
+	installed := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "1", "Depends": "b"},
+		map[string]string{"Package": "b", "Version": "1", "Depends": "c | d"},
+		map[string]string{"Package": "c", "Version": "1"},
+		map[string]string{"Package": "d", "Version": "1"},
+		map[string]string{"Package": "e", "Version": "1", "Pre-Depends": "c"},
+		map[string]string{"Package": "f", "Version": "1", "Depends": "missing"},
+	)
+
+	removals, err := installed.RemovalImpact("c")
+	if err != nil {
+		t.Fatalf("RemovalImpact() returned err: %v", err)
+	}
+	var got []string
+	for _, r := range removals {
+		got = append(got, r.Package)
+	}
+	if want := []string{"e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RemovalImpact(c) = %v, want %v", got, want)
+	}
+
+	removals, err = installed.RemovalImpact("b")
+	if err != nil {
+		t.Fatalf("RemovalImpact() returned err: %v", err)
+	}
+	if len(removals) != 1 || removals[0].Package != "a" || removals[0].Reason != "a Depends: b" {
+		t.Errorf("RemovalImpact(b) = %+v, want [a]", removals)
+	}
+
+	if _, err := installed.RemovalImpact("missing"); err == nil {
+		t.Error("RemovalImpact() of package which is not installed returned nil error")
+	}
+}
+
+func TestAutoremovable(t *testing.T) {
+	installed := makePkgInfo(t,
+		map[string]string{"Package": "app", "Version": "1", "Depends": "lib", "Recommends": "extra"},
+		map[string]string{"Package": "lib", "Version": "1", "Depends": "virtual"},
+		map[string]string{"Package": "impl", "Version": "1", "Provides": "virtual"},
+		map[string]string{"Package": "extra", "Version": "1"},
+		map[string]string{"Package": "orphan", "Version": "1", "Depends": "orphan-lib"},
+		map[string]string{"Package": "orphan-lib", "Version": "1"},
+		map[string]string{"Package": "ess", "Version": "1", "Essential": "yes"},
+	)
+	auto, err := ReadExtendedStates(strings.NewReader(`Package: lib
+Architecture: amd64
+Auto-Installed: 1
+
+Package: impl
+Architecture: amd64
+Auto-Installed: 1
+
+Package: extra
+Architecture: amd64
+Auto-Installed: 1
+
+Package: orphan
+Architecture: amd64
+Auto-Installed: 1
+
+Package: orphan-lib
+Architecture: amd64
+Auto-Installed: 1
+
+Package: ess
+Architecture: amd64
+Auto-Installed: 1
+
+Package: app
+Architecture: amd64
+Auto-Installed: 0
+
+`), "amd64")
+	if err != nil {
+		t.Fatalf("ReadExtendedStates() returned err: %v", err)
+	}
+	if len(auto) != 6 || auto["app"] {
+		t.Errorf("ReadExtendedStates() = %v", auto)
+	}
+
+	removals, err := installed.Autoremovable(auto)
+	if err != nil {
+		t.Fatalf("Autoremovable() returned err: %v", err)
+	}
+	var got []string
+	for _, r := range removals {
+		got = append(got, r.Package)
+	}
+	if want := []string{"orphan", "orphan-lib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Autoremovable() = %v, want %v", got, want)
+	}
+}
+
+func TestAutoremovableMultiarch(t *testing.T) {
+	installed := makeConfiguredPkgInfo(t, multiarchConfig,
+		map[string]string{"Package": "app", "Version": "1", "Architecture": "amd64", "Depends": "libfoo"},
+		map[string]string{"Package": "libfoo", "Version": "1", "Architecture": "amd64", "Multi-Arch": "same"},
+		map[string]string{"Package": "libfoo", "Version": "1", "Architecture": "i386", "Multi-Arch": "same"},
+		map[string]string{"Package": "tool", "Version": "1", "Architecture": "all"},
+	)
+	auto, err := ReadExtendedStates(strings.NewReader(`Package: libfoo
+Architecture: amd64
+Auto-Installed: 1
+
+Package: libfoo
+Architecture: i386
+Auto-Installed: 1
+
+Package: tool
+Architecture: all
+Auto-Installed: 1
+
+`), "amd64")
+	if err != nil {
+		t.Fatalf("ReadExtendedStates() returned err: %v", err)
+	}
+	if want := map[string]bool{"libfoo": true, "libfoo:i386": true, "tool": true}; !reflect.DeepEqual(auto, want) {
+		t.Errorf("ReadExtendedStates() = %v, want %v", auto, want)
+	}
+
+	removals, err := installed.Autoremovable(auto)
+	if err != nil {
+		t.Fatalf("Autoremovable() returned err: %v", err)
+	}
+	var got []string
+	for _, r := range removals {
+		got = append(got, r.Package)
+	}
+	if want := []string{"libfoo:i386", "tool"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Autoremovable() = %v, want %v", got, want)
+	}
+}
@@ -1,11 +1,15 @@
 package debdep
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"sort"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/twitchyliquid64/debdep/deb"
 
@@ -18,6 +22,22 @@ type ErrDependency struct {
 	RequiredByPackage string
 	RequiredByVersion string
 	VersionConstraint *deb.VersionConstraint
+
+	// Chain is the path of requirements from the requested target to the
+	// package which had the unsatisfiable relation.
+	Chain WhyChain
+	// Rejected lists the available versions of DependencyPackage, none
+	// of which met VersionConstraint.
+	Rejected []string
+	// Alternatives is populated when the unsatisfiable relation was a set
+	// of alternatives, and describes why each alternative failed.
+	Alternatives []ErrDependency
+	// Relation is the relation which could not be satisfied.
+	Relation deb.Requirement
+	// Excluded and Held list the packages which could have satisfied
+	// Relation, but were excluded or held by ResolveOptions.
+	Excluded []string
+	Held     []string
 }
 
 func (e ErrDependency) Error() string {
@@ -26,12 +46,101 @@ func (e ErrDependency) Error() string {
 		base = fmt.Sprintf("required package %q", e.DependencyPackage)
 	}
 
-	if e.VersionConstraint == nil {
-		return base + " was not found"
-	} else {
+	switch {
+	case len(e.Alternatives) > 0:
+		base = fmt.Sprintf("package %q (%s) required %q", e.RequiredByPackage, e.RequiredByVersion, e.Relation.String())
+		if e.RequiredByPackage == "" {
+			base = fmt.Sprintf("required %q", e.Relation.String())
+		}
+		base += ", but no alternative could be satisfied"
+		var reasons []string
+		for _, alt := range e.Alternatives {
+			reasons = append(reasons, alt.Error())
+		}
+		base += " (" + strings.Join(reasons, "; ") + ")"
+	case len(e.Excluded) > 0 || len(e.Held) > 0:
+		base += ", but every candidate is excluded or held"
+	case e.VersionConstraint == nil:
+		base += " was not found"
+	default:
 		base += fmt.Sprintf(" with version %s %q, but it was not found", e.VersionConstraint.ConstraintRelation, e.VersionConstraint.Version)
-		return base
+		if len(e.Rejected) > 0 {
+			base += fmt.Sprintf(" (rejected versions: %s)", strings.Join(e.Rejected, ", "))
+		}
+	}
+	return base
+}
+
+// Explain writes a multi-line description of the failure, including the
+// chain of requirements from the requested target.
+func (e ErrDependency) Explain(w io.Writer) {
+	e.explain(w, 0, 0)
+}
+
+func (e ErrDependency) explain(w io.Writer, depth, parentChainLen int) {
+	indent := strings.Repeat("  ", depth)
+	if len(e.Alternatives) > 0 {
+		fmt.Fprintf(w, "%sno alternative of %q could be satisfied\n", indent, e.Relation.String())
+	} else {
+		fmt.Fprintf(w, "%s%q could not be satisfied\n", indent, e.Relation.String())
+		if len(e.Rejected) > 0 {
+			fmt.Fprintf(w, "%s  rejected versions: %s\n", indent, strings.Join(e.Rejected, ", "))
+		}
+		if len(e.Excluded) > 0 {
+			fmt.Fprintf(w, "%s  excluded: %s\n", indent, strings.Join(e.Excluded, ", "))
+		}
+		if len(e.Held) > 0 {
+			fmt.Fprintf(w, "%s  held: %s\n", indent, strings.Join(e.Held, ", "))
+		}
+	}
+	// Alternatives which failed immediately share the chain of their parent,
+	// so it is only printed when it provides new information.
+	if len(e.Chain) > 0 && len(e.Chain) != parentChainLen {
+		fmt.Fprintf(w, "%s  required via:\n", indent)
+		for _, link := range e.Chain {
+			fmt.Fprintf(w, "%s    %s\n", indent, link.String())
+		}
+	}
+	for _, alt := range e.Alternatives {
+		alt.explain(w, depth+1, len(e.Chain))
+	}
+}
+
+// newErrDependency returns an ErrDependency describing the failure to satisfy
+// req, which was reached via the given chain of requirements.
+func newErrDependency(chain WhyChain, req deb.Requirement) ErrDependency {
+	out := ErrDependency{
+		DependencyPackage: req.Package,
+		VersionConstraint: req.VersionConstraint,
+		Chain:             chain,
+		Relation:          req,
+	}
+	if len(chain) > 0 {
+		last := chain[len(chain)-1]
+		out.RequiredByPackage = last.Package
+		out.RequiredByVersion = last.Version.String()
 	}
+	return out
+}
+
+// extendChain returns a copy of chain, with a link appended describing
+// the relations of the given package which are being resolved.
+func extendChain(chain WhyChain, pkg string, v version.Version, field string, rel deb.Requirement) WhyChain {
+	out := make(WhyChain, len(chain), len(chain)+1)
+	copy(out, chain)
+	return append(out, WhyLink{Package: pkg, Version: v, Field: field, Relation: rel})
+}
+
+// narrowChain returns a copy of chain, with the relation of the last link
+// replaced by the given requirement.
+func narrowChain(chain WhyChain, rel deb.Requirement) WhyChain {
+	if len(chain) == 0 {
+		return chain
+	}
+	out := make(WhyChain, len(chain))
+	copy(out, chain)
+	out[len(out)-1].Relation = rel
+	return out
 }
 
 // OperationKind describes the kind of operation in a sequence of operations.
@@ -43,6 +152,12 @@ func (o OperationKind) String() string {
 		return "package-dep"
 	case CompositeDependencyOp:
 		return "composite"
+	case DebPackageRemoveOp:
+		return "package-remove"
+	case DebPackageUnpackOp:
+		return "package-unpack"
+	case DebPackageConfigureOp:
+		return "package-configure"
 	}
 	return "?OperationKind?"
 }
@@ -51,6 +166,12 @@ func (o OperationKind) String() string {
 const (
 	DebPackageInstallOp OperationKind = iota
 	CompositeDependencyOp
+	DebPackageRemoveOp
+	// DebPackageUnpackOp and DebPackageConfigureOp are the two phases of
+	// installing a package, as performed by dpkg --unpack and
+	// dpkg --configure. See InstallPhases.
+	DebPackageUnpackOp
+	DebPackageConfigureOp
 )
 
 // Operation represents an operation in a tree of dependencies/operations.
@@ -58,9 +179,16 @@ type Operation struct {
 	Kind                OperationKind
 	DependentOperations []*Operation
 
+	// Package is the name the package is stored under in
+	// PackageInfo.Packages, so packages of a foreign architecture are
+	// qualified with their architecture, such as libc6:i386.
 	Package string
 	Version version.Version
+	Arch    string
 	PreDep  bool
+	// Dependencies lists the packages in the install graph which were
+	// chosen to satisfy the Pre-Depends and Depends of the package.
+	Dependencies []DependencyEdge
 }
 
 // PrettyWrite generates a human-friendly representation of the operation.
@@ -85,6 +213,8 @@ func (o *Operation) PrettyWrite(w io.Writer, depth int) error {
 		}
 		w.Write([]byte("] "))
 		w.Write([]byte(o.Package + " (" + o.Version.String() + ")\n"))
+	case DebPackageRemoveOp, DebPackageUnpackOp, DebPackageConfigureOp:
+		w.Write([]byte(o.Package + " (" + o.Version.String() + ")\n"))
 	}
 
 	return nil
@@ -94,7 +224,7 @@ func (o *Operation) PrettyWrite(w io.Writer, depth int) error {
 func (o *Operation) Unroll() []Operation {
 	var out []Operation
 	switch o.Kind {
-	case DebPackageInstallOp:
+	case DebPackageInstallOp, DebPackageRemoveOp, DebPackageUnpackOp, DebPackageConfigureOp:
 		out = append(out, *o)
 	case CompositeDependencyOp:
 		for _, c := range o.DependentOperations {
@@ -105,31 +235,238 @@ func (o *Operation) Unroll() []Operation {
 	return out
 }
 
+// coveredDeps tracks the requirements and packages which are already part
+// of the install graph. Additions are logged in order, so that they can be
+// undone by reset.
 type coveredDeps struct {
-	Requirements []deb.Requirement
-	Packages     []struct {
-		Name            string
-		Version         string
-		VirtualProvides []string // Virtual packages this package provides.
-	}
+	requirements map[requirementKey]bool
+	packages     map[packageKey]bool
+	// choices records the package chosen to satisfy each requirement.
+	choices map[requirementKey]chosenPackage
+
+	requirementLog []requirementKey
+	packageLog     []packageKey
+}
+
+// requirementKey identifies a requirement declared by a package of some
+// architecture. Requirements are keyed by their canonical string form.
+type requirementKey struct {
+	relation string
+	arch     string
+}
+
+// packageKey identifies a package in the install graph.
+type packageKey struct {
+	name, version, arch string
+}
+
+// chosenPackage is the package chosen to satisfy a requirement. The name is
+// empty if the requirement is satisfied outside of the install graph, such
+// as by an installed package.
+type chosenPackage struct {
+	name    string
+	version version.Version
+}
+
+// ResolveOptions configures how dependencies are resolved.
+type ResolveOptions struct {
+	// Essential causes packages marked Essential to be treated as
+	// implicitly required, as packages need not declare dependencies on
+	// them. Essential packages which are not installed are placed first
+	// in the install graph, ahead of the targets.
+	Essential bool
+
+	// Exclude lists packages which must never be installed, and Hold
+	// packages which must be kept at their installed version, so are
+	// never installed or upgraded. Entries are package names, which may
+	// be qualified with an architecture such as libc6:i386. Relations are
+	// satisfied by other alternatives or providers where possible, and
+	// otherwise fail with an ErrDependency listing the excluded or held
+	// candidates.
+	Exclude []string
+	Hold    []string
+	// Provided lists packages which are provided externally, such as a
+	// replacement supplied by the user. Relations naming them are treated
+	// as satisfied, whatever version they require.
+	Provided []string
+
+	// MaxDepth limits the length of chains of dependencies which are
+	// followed, and MaxNodes the number of package relations evaluated.
+	// Timeout limits the time spent resolving. Zero values mean no limit.
+	// An ErrLimit is returned if a limit is exceeded.
+	MaxDepth int
+	MaxNodes int
+	Timeout  time.Duration
+}
+
+// resolveState tracks the progress of resolving an install graph.
+type resolveState struct {
+	ctx       context.Context
+	covered   coveredDeps
+	installed *PackageInfo
+	opts      ResolveOptions
+	nodes     int
+
+	excluded, held, provided map[string]bool
 }
 
 // InstallGraph computes the operations necessary to install the target, given
-// the set of already-installed targets.
+// the set of already-installed targets. The target is parsed using
+// ParseTargetSpec, so may constrain the version to be installed.
 func (p *PackageInfo) InstallGraph(target string, installed *PackageInfo) (*Operation, error) {
-	var coveredDeps coveredDeps
-	return p.buildInstallGraph(target, &coveredDeps, installed)
+	return p.InstallGraphContext(context.Background(), target, installed, ResolveOptions{})
 }
 
-func (p *PackageInfo) buildInstallGraph(target string, coveredDeps *coveredDeps, installed *PackageInfo) (*Operation, error) {
-	pkg, err := p.FindLatest(target)
+// InstallGraphContext is like InstallGraph, but resolution is abandoned
+// with an ErrLimit if ctx is done or a limit set in opts is exceeded. If
+// opts.Essential is set, the target is resolved as by InstallGraphMulti.
+func (p *PackageInfo) InstallGraphContext(ctx context.Context, target string, installed *PackageInfo, opts ResolveOptions) (*Operation, error) {
+	if opts.Essential {
+		return p.InstallGraphMultiContext(ctx, []string{target}, installed, opts)
+	}
+	req, err := ParseTargetSpec(target)
+	if err != nil {
+		return nil, fmt.Errorf("parsing target %q: %v", target, err)
+	}
+	state, cancel := newResolveState(ctx, installed, opts)
+	defer cancel()
+	if req.Kind == deb.PackageRelationRequirement && req.VersionConstraint == nil && req.ArchConstraint == (deb.Arch{}) {
+		return p.buildInstallGraph(state, req.Package)
+	}
+	return p.buildInstallGraphRequirement(state, req, "", nil, false)
+}
+
+// InstallGraphMulti computes the operations necessary to install all of the
+// targets, given the set of already-installed packages. Targets are resolved
+// jointly, so packages needed by several targets appear in the graph once.
+// Targets already satisfied by installed packages are skipped. installed is
+// not modified.
+//
+// Each target is parsed using ParseTargetSpec, so may constrain the version
+// to be installed.
+func (p *PackageInfo) InstallGraphMulti(targets []string, installed *PackageInfo, opts ResolveOptions) (*Operation, error) {
+	return p.InstallGraphMultiContext(context.Background(), targets, installed, opts)
+}
+
+// InstallGraphMultiContext is like InstallGraphMulti, but resolution is
+// abandoned with an ErrLimit if ctx is done or a limit set in opts is
+// exceeded.
+func (p *PackageInfo) InstallGraphMultiContext(ctx context.Context, targets []string, installed *PackageInfo, opts ResolveOptions) (*Operation, error) {
+	if installed == nil {
+		installed = &PackageInfo{}
+	}
+	state, cancel := newResolveState(ctx, installed, opts)
+	defer cancel()
+
+	out := &Operation{Kind: CompositeDependencyOp}
+	if opts.Essential {
+		for _, name := range p.GetAllEssential() {
+			if listedName(state.excluded, name, p.Config.Arch.Arch) || listedName(state.held, name, p.Config.Arch.Arch) {
+				continue // Essential packages may be explicitly left out.
+			}
+			req := deb.Requirement{Kind: deb.PackageRelationRequirement, Package: name}
+			op, err := p.buildInstallGraphRequirement(state, req, "", nil, false)
+			if err != nil {
+				return nil, err
+			}
+			out.DependentOperations = append(out.DependentOperations, op)
+		}
+	}
+	for _, target := range targets {
+		req, err := ParseTargetSpec(target)
+		if err != nil {
+			return nil, fmt.Errorf("parsing target %q: %v", target, err)
+		}
+		op, err := p.buildInstallGraphRequirement(state, req, "", nil, false)
+		if err != nil {
+			return nil, err
+		}
+		out.DependentOperations = append(out.DependentOperations, op)
+	}
+	return out, nil
+}
+
+// ParseTargetSpec parses a description of a package to be installed. Targets
+// use the syntax of relations in control files, such as "foo (>= 2.0)" or
+// "foo | bar", and may be qualified with an architecture, such as
+// "libc6:i386". The apt-style "foo=1.2-3" is accepted as shorthand for
+// "foo (= 1.2-3)".
+func ParseTargetSpec(spec string) (deb.Requirement, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return deb.Requirement{}, errors.New("empty target")
+	}
+	if idx := strings.Index(spec, "="); idx > 0 && !strings.ContainsAny(spec, "(|,") {
+		spec = strings.TrimSpace(spec[:idx]) + " (= " + strings.TrimSpace(spec[idx+1:]) + ")"
+	}
+	return deb.ParsePackageRelations(spec, "")
+}
+
+// SplitTargetSpecs splits a list of targets, as accepted by ParseTargetSpec,
+// separated by commas or whitespace. Whitespace within parentheses or
+// around alternatives does not separate targets, so
+// "libc6 (>= 2.36) foo | bar baz=1.0" is split into "libc6 (>= 2.36)",
+// "foo | bar" and "baz=1.0".
+func SplitTargetSpecs(in string) []string {
+	var (
+		out   []string
+		depth int
+		cur   strings.Builder
+	)
+	flush := func() {
+		if spec := strings.TrimSpace(cur.String()); spec != "" {
+			out = append(out, spec)
+		}
+		cur.Reset()
+	}
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		switch {
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ',' && depth == 0:
+			flush()
+			continue
+		case unicode.IsSpace(rune(c)) && depth == 0:
+			rest := strings.TrimLeftFunc(in[i:], unicode.IsSpace)
+			prev := strings.TrimRightFunc(cur.String(), unicode.IsSpace)
+			if rest == "" || rest[0] == '(' || rest[0] == '|' || strings.HasSuffix(prev, "|") {
+				break
+			}
+			flush()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	flush()
+	return out
+}
+
+func (p *PackageInfo) buildInstallGraph(state *resolveState, target string) (*Operation, error) {
+	if listedName(state.provided, target, p.Config.Arch.Arch) {
+		return &Operation{Kind: CompositeDependencyOp}, nil
+	}
+	pkg, err := p.FindCandidate(target)
 	if err != nil {
+		if err == os.ErrNotExist {
+			return nil, newErrDependency(nil, deb.Requirement{Kind: deb.PackageRelationRequirement, Package: target})
+		}
 		return nil, err
 	}
+	if reason := state.blocked(pkg); reason != "" {
+		e := newErrDependency(nil, deb.Requirement{Kind: deb.PackageRelationRequirement, Package: target})
+		e.addBlocked(p, reason, pkg)
+		return nil, e
+	}
 	vers, err := pkg.Version()
 	if err != nil {
 		return nil, err
 	}
+	name := p.QualifiedName(pkg.Name(), pkg.Arch())
+	arch := effectiveArch(pkg, p.Config.Arch.Arch)
+	checkSetCoveredPackage(&state.covered, name, vers.String(), pkg.Arch())
 
 	out := &Operation{Kind: CompositeDependencyOp}
 
@@ -139,7 +476,8 @@ func (p *PackageInfo) buildInstallGraph(target string, coveredDeps *coveredDeps,
 		return nil, err
 	}
 	if preDeps.Kind != deb.AndCompositeRequirement || len(preDeps.Children) > 0 {
-		op, err := p.buildInstallGraphRequirement(coveredDeps, installed, preDeps, deb.Requirement{}, true)
+		chain := extendChain(nil, name, vers, "Pre-Depends", preDeps)
+		op, err := p.buildInstallGraphRequirement(state, preDeps, arch, chain, true)
 		if err != nil {
 			return nil, err
 		}
@@ -150,20 +488,26 @@ func (p *PackageInfo) buildInstallGraph(target string, coveredDeps *coveredDeps,
 	if err != nil {
 		return nil, err
 	}
-	op, err := p.buildInstallGraphRequirement(coveredDeps, installed, deps, deb.Requirement{}, false)
+	chain := extendChain(nil, name, vers, "Depends", deps)
+	op, err := p.buildInstallGraphRequirement(state, deps, arch, chain, false)
 	if err != nil {
 		return nil, err
 	}
 	out.DependentOperations = append(out.DependentOperations, op)
 	out.DependentOperations = append(out.DependentOperations, &Operation{
-		Kind:    DebPackageInstallOp,
-		Package: pkg.Name(),
-		Version: vers,
+		Kind:         DebPackageInstallOp,
+		Package:      name,
+		Version:      vers,
+		Arch:         pkg.Arch(),
+		Dependencies: state.covered.dependencyEdges(name, vers, arch, preDeps, deps),
 	})
 	return out, nil
 }
 
-func (p *PackageInfo) buildInstallGraphRequirement(coveredDeps *coveredDeps, installed *PackageInfo, req deb.Requirement, parent deb.Requirement, isPreDep bool) (out *Operation, err error) {
+// buildInstallGraphRequirement computes the sub-graph satisfying req, which
+// is declared by a package of architecture parentArch. An empty parentArch
+// denotes the native architecture.
+func (p *PackageInfo) buildInstallGraphRequirement(state *resolveState, req deb.Requirement, parentArch string, chain WhyChain, isPreDep bool) (out *Operation, err error) {
 	defer func() {
 		// To neaten the AST a little, if we are returning a composite node
 		// containing a single node, we delete the composite and just return
@@ -173,7 +517,10 @@ func (p *PackageInfo) buildInstallGraphRequirement(coveredDeps *coveredDeps, ins
 		}
 	}()
 
-	if checkSetCoveredDependency(coveredDeps, req) {
+	if parentArch == "" {
+		parentArch = p.Config.Arch.Arch
+	}
+	if checkSetCoveredDependency(&state.covered, req, parentArch) {
 		// If this requirement has already been satisfied verbatium, we
 		// return early (An empty CompositeDependencyOp symbolizes a no-op).
 		return &Operation{Kind: CompositeDependencyOp}, nil
@@ -185,7 +532,7 @@ func (p *PackageInfo) buildInstallGraphRequirement(coveredDeps *coveredDeps, ins
 		// We simply recurse to allow their dependencies to lead in the graph.
 		var ops []*Operation
 		for _, dep := range req.Children {
-			op, err := p.buildInstallGraphRequirement(coveredDeps, installed, dep, req, isPreDep)
+			op, err := p.buildInstallGraphRequirement(state, dep, parentArch, narrowChain(chain, dep), isPreDep)
 			if err != nil {
 				return nil, err
 			}
@@ -199,54 +546,37 @@ func (p *PackageInfo) buildInstallGraphRequirement(coveredDeps *coveredDeps, ins
 	case deb.PackageRelationRequirement:
 		// Handle a requirement for a single package, which
 		// may be constrained by a version relationship.
+		if err := state.explore(chain); err != nil {
+			return nil, err
+		}
 
-		// Check if the requirement is already satisfied by installed packages.
-		isInstalled, err := installed.HasPackage(req)
+		// Check if the requirement is already satisfied by installed, or
+		// externally provided, packages.
+		isInstalled, err := state.installed.hasRelation(req, parentArch)
 		if err != nil {
 			return nil, err
 		}
-		if isInstalled {
+		if isInstalled || p.isProvided(state, req, parentArch) {
+			state.covered.choose(req, parentArch, chosenPackage{})
 			return &Operation{Kind: CompositeDependencyOp}, nil
 		}
 
-		var selected *deb.Paragraph
-		// TODO: Decompose into its own function.
-		if req.VersionConstraint == nil { // No version relationship, lets use the latest.
-			latest, err := p.FindLatest(req.Package) //TODO: filter on arch?
-			if err != nil {
-				if err == os.ErrNotExist {
-					virtualCandidates, err := p.FindProvides(req.Package)
-					if err != nil {
-						if err == os.ErrNotExist {
-							return nil, ErrDependency{
-								DependencyPackage: req.Package,
-								RequiredByPackage: parent.Package,
-							}
-						}
-						return nil, err
-					}
-					selected = virtualCandidates[0]
-				} else {
-					return nil, err
+		// Choose the candidate satisfying the requirement, which may be
+		// a package providing it if unversioned.
+		selected, blocked, err := p.findAllowedRelation(state, req, parentArch)
+		if err != nil {
+			if err == os.ErrNotExist {
+				e := newErrDependency(chain, req)
+				for _, b := range blocked {
+					e.addBlocked(p, state.blocked(b), b)
 				}
-			} else {
-				selected = latest
-			}
-		} else {
-			pkg, err := p.FindWithVersionConstraint(req)
-			if err != nil {
-				if err == os.ErrNotExist {
-					return nil, ErrDependency{
-						DependencyPackage: req.Package,
-						RequiredByPackage: parent.Package,
-						VersionConstraint: req.VersionConstraint,
-					}
+				if req.VersionConstraint != nil && len(blocked) == 0 {
+					e.Rejected = p.rejectedVersions(req, parentArch)
 				}
-				return nil, err
+				return nil, e
 			}
-			selected = pkg
+			return nil, err
 		}
-
 		v, err := selected.Version()
 		if err != nil {
 			return nil, err
@@ -254,7 +584,10 @@ func (p *PackageInfo) buildInstallGraphRequirement(coveredDeps *coveredDeps, ins
 
 		// Another short-circuit: if we already have installed this package+version,
 		// we bail out by returning a structure symbolizing a no-op.
-		if checkSetCoveredPackage(coveredDeps, selected.Name(), v.String(), selected.Provides()) {
+		name := p.QualifiedName(selected.Name(), selected.Arch())
+		arch := effectiveArch(selected, p.Config.Arch.Arch)
+		state.covered.choose(req, parentArch, chosenPackage{name: name, version: v})
+		if checkSetCoveredPackage(&state.covered, name, v.String(), selected.Arch()) {
 			return &Operation{Kind: CompositeDependencyOp}, nil
 		}
 
@@ -265,7 +598,8 @@ func (p *PackageInfo) buildInstallGraphRequirement(coveredDeps *coveredDeps, ins
 		}
 		var preOps *Operation
 		if preDeps.Kind != deb.AndCompositeRequirement || len(preDeps.Children) > 0 {
-			preOps, err = p.buildInstallGraphRequirement(coveredDeps, installed, preDeps, req, true)
+			preChain := extendChain(chain, name, v, "Pre-Depends", preDeps)
+			preOps, err = p.buildInstallGraphRequirement(state, preDeps, arch, preChain, true)
 			if err != nil {
 				return nil, err
 			}
@@ -276,16 +610,19 @@ func (p *PackageInfo) buildInstallGraphRequirement(coveredDeps *coveredDeps, ins
 		if err != nil {
 			return nil, err
 		}
-		nextOps, err := p.buildInstallGraphRequirement(coveredDeps, installed, nextDeps, req, false)
+		nextChain := extendChain(chain, name, v, "Depends", nextDeps)
+		nextOps, err := p.buildInstallGraphRequirement(state, nextDeps, arch, nextChain, false)
 		if err != nil {
 			return nil, err
 		}
 
 		pkgOp := &Operation{
-			Kind:    DebPackageInstallOp,
-			Package: selected.Name(),
-			Version: v,
-			PreDep:  isPreDep,
+			Kind:         DebPackageInstallOp,
+			Package:      name,
+			Version:      v,
+			Arch:         selected.Arch(),
+			PreDep:       isPreDep,
+			Dependencies: state.covered.dependencyEdges(name, v, arch, preDeps, nextDeps),
 		}
 
 		if nextOps.Kind == CompositeDependencyOp && len(nextOps.DependentOperations) == 0 && preOps == nil {
@@ -318,55 +655,117 @@ func (p *PackageInfo) buildInstallGraphRequirement(coveredDeps *coveredDeps, ins
 
 	case deb.OrCompositeRequirement:
 		// Handle requirements where only one of several need to be satisfied.
-		// We select the first one from the list which can be satisfied.
+		// As with apt, an alternative which is already installed or part
+		// of the install graph is used if there is one. Otherwise, we
+		// select the first one from the list which can be satisfied.
+		chosen, satisfied, err := p.satisfiedAlternative(state, req, parentArch)
+		if err != nil {
+			return nil, err
+		}
+		if satisfied {
+			state.covered.choose(req, parentArch, chosen)
+			return &Operation{Kind: CompositeDependencyOp}, nil
+		}
+		failure := newErrDependency(chain, req)
 		for _, candidateDep := range req.Children {
-			op, err := p.buildInstallGraphRequirement(coveredDeps, installed, candidateDep, req, isPreDep)
+			mark := state.covered.mark()
+			op, err := p.buildInstallGraphRequirement(state, candidateDep, parentArch, chain, isPreDep)
 			if err != nil {
-				if _, wasDep := err.(ErrDependency); wasDep {
+				if depErr, wasDep := err.(ErrDependency); wasDep {
+					// Forget anything covered by the failed alternative, as
+					// it will not be part of the install graph.
+					state.covered.reset(mark)
+					failure.Alternatives = append(failure.Alternatives, depErr)
 					continue
 				}
 				return nil, err
 			}
+			chosen, _ := state.covered.chosen(candidateDep, parentArch)
+			state.covered.choose(req, parentArch, chosen)
 			return op, nil
 		}
-		return nil, errors.New("no package meeting any requirement available")
+		return nil, failure
 
 	default:
 		return nil, fmt.Errorf("cannot process requirement type %d", req.Kind)
 	}
-	return nil, nil
 }
 
-// FindAll returns all packages with a given name, indexed by version.
-func (p *PackageInfo) FindAll(target string) (map[version.Version]*deb.Paragraph, error) {
-	pkgs, ok := p.Packages[target]
-	if !ok {
-		return nil, os.ErrNotExist
+// satisfiedAlternative returns true if any alternative of req is satisfied
+// by installed or externally provided packages, or by a package already
+// chosen for the install graph, along with the package chosen.
+func (p *PackageInfo) satisfiedAlternative(state *resolveState, req deb.Requirement, parentArch string) (chosenPackage, bool, error) {
+	for _, alt := range req.Children {
+		if alt.Kind != deb.PackageRelationRequirement {
+			continue
+		}
+		if p.isProvided(state, alt, parentArch) {
+			return chosenPackage{}, true, nil
+		}
+		if state.covered.requirements[requirementKey{relation: alt.String(), arch: parentArch}] {
+			chosen, _ := state.covered.chosen(alt, parentArch)
+			return chosen, true, nil
+		}
+		isInstalled, err := state.installed.hasRelation(alt, parentArch)
+		if err != nil || isInstalled {
+			return chosenPackage{}, isInstalled, err
+		}
+
+		groups, err := p.relationCandidates(alt, parentArch)
+		if err != nil {
+			return chosenPackage{}, false, err
+		}
+		for _, group := range groups {
+			for _, pkg := range group {
+				v, err := pkg.Version()
+				if err != nil {
+					return chosenPackage{}, false, err
+				}
+				key := packageKey{name: p.QualifiedName(pkg.Name(), pkg.Arch()), version: v.String(), arch: pkg.Arch()}
+				if state.covered.packages[key] {
+					return chosenPackage{name: key.name, version: v}, true, nil
+				}
+			}
+		}
 	}
-	return pkgs, nil
+	return chosenPackage{}, false, nil
 }
 
-func filterCompatibleArch(pkgs map[version.Version]*deb.Paragraph, archSpec deb.Arch) map[version.Version]*deb.Paragraph {
-	out := make(map[version.Version]*deb.Paragraph, len(pkgs))
-	for v, p := range pkgs {
-		switch {
-		case archSpec.Arch == "" && !archSpec.Any: // nothing specified, everything permitted.
-			out[v] = p
-		case archSpec.Arch != "" && !archSpec.Any: // Arch specified, must match or be irrelevant.
-			if p.Arch() == "all" || p.Arch() == archSpec.Arch || p.ForeignDepSatisfiable() {
-				out[v] = p
-			}
-		case archSpec.Any:
-			// Relying package specified any arch can satisfy & the dependency agrees.
-			if p.MultiarchAllowed() {
-				out[v] = p
+// rejectedVersions returns the versions of the required package which are
+// available, for reporting why a version constraint could not be met.
+func (p *PackageInfo) rejectedVersions(req deb.Requirement, parentArch string) []string {
+	unversioned := req
+	unversioned.VersionConstraint = nil
+	var vers []version.Version
+	for _, key := range p.relationKeys(unversioned, parentArch) {
+		for v, pkg := range p.Packages[key] {
+			if archSatisfies(pkg, unversioned, parentArch, p.Config.Arch.Arch) {
+				vers = append(vers, v)
 			}
 		}
 	}
+	sort.Slice(vers, func(i, j int) bool {
+		return vers[i].LessThan(vers[j])
+	})
 
+	var out []string
+	for _, v := range vers {
+		if len(out) == 0 || out[len(out)-1] != v.String() {
+			out = append(out, v.String())
+		}
+	}
 	return out
 }
 
+// FindAll returns all packages with a given name, indexed by version.
+func (p *PackageInfo) FindAll(target string) (map[version.Version]*deb.Paragraph, error) {
+	pkgs, ok := p.Packages[target]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return pkgs, nil
+}
+
 // FindLatest returns the latest version of the package with the given name.
 func (p *PackageInfo) FindLatest(target string) (*deb.Paragraph, error) {
 	pkgs, err := p.FindAll(target)
@@ -374,17 +773,7 @@ func (p *PackageInfo) FindLatest(target string) (*deb.Paragraph, error) {
 		return nil, err
 	}
 
-	vers := make([]version.Version, len(pkgs))
-	count := 0
-	for v, _ := range pkgs {
-		vers[count] = v
-		count++
-	}
-
-	sort.Slice(vers, func(i, j int) bool {
-		return vers[i].LessThan(vers[j])
-	})
-
+	vers := sortedVersions(pkgs)
 	return pkgs[vers[len(vers)-1]], nil
 }
 
@@ -398,106 +787,117 @@ func (p *PackageInfo) FindProvides(target string) ([]*deb.Paragraph, error) {
 }
 
 // FindWithVersionConstraint tries to find a version of the package that satisfies the
-// given version constraint.
+// given version constraint. If several versions do, the one with the highest
+// priority is returned. Packages of the native architecture are preferred.
 func (p *PackageInfo) FindWithVersionConstraint(req deb.Requirement) (*deb.Paragraph, error) {
-	pkgs, err := p.FindAll(req.Package)
-	if err != nil {
-		return nil, err
-	}
-	pkgs = filterCompatibleArch(pkgs, req.ArchConstraint)
+	return p.findRelation(req, "")
+}
 
-	v, err := version.NewVersion(req.VersionConstraint.Version)
-	if err != nil {
-		return nil, err
-	}
+// coveredMark records the extent of a coveredDeps, so that later additions
+// can be undone.
+type coveredMark struct {
+	requirements, packages int
+}
 
-	getSorted := func() []version.Version {
-		vers := make([]version.Version, len(pkgs))
-		count := 0
-		for v, _ := range pkgs {
-			vers[count] = v
-			count++
-		}
+func (c *coveredDeps) mark() coveredMark {
+	return coveredMark{requirements: len(c.requirementLog), packages: len(c.packageLog)}
+}
 
-		sort.Slice(vers, func(i, j int) bool {
-			return vers[i].LessThan(vers[j])
-		})
-		return vers
+// reset forgets everything covered since the mark was taken.
+func (c *coveredDeps) reset(m coveredMark) {
+	for _, k := range c.requirementLog[m.requirements:] {
+		delete(c.requirements, k)
+		delete(c.choices, k)
 	}
+	for _, k := range c.packageLog[m.packages:] {
+		delete(c.packages, k)
+	}
+	c.requirementLog = c.requirementLog[:m.requirements]
+	c.packageLog = c.packageLog[:m.packages]
+}
 
-	switch req.VersionConstraint.ConstraintRelation {
-	case deb.ConstraintEquals:
-		pkg, ok := pkgs[v]
-		if !ok {
-			return nil, os.ErrNotExist
-		}
-		return pkg, nil
-
-	case deb.ConstraintLessThan:
-		sorted := getSorted()
-		for i := len(sorted) - 1; i >= 0; i-- {
-			if sorted[i].LessThan(v) {
-				return pkgs[sorted[i]], nil
-			}
-		}
-
-	case deb.ConstraintGreaterThan:
-		sorted := getSorted()
-		for i := len(sorted) - 1; i >= 0; i-- {
-			if sorted[i].GreaterThan(v) {
-				return pkgs[sorted[i]], nil
-			}
-		}
+// choose records the package chosen to satisfy req, which is declared by a
+// package of the given architecture.
+func (c *coveredDeps) choose(req deb.Requirement, arch string, chosen chosenPackage) {
+	if c.choices == nil {
+		c.choices = map[requirementKey]chosenPackage{}
+	}
+	c.choices[requirementKey{relation: req.String(), arch: arch}] = chosen
+}
 
-	case deb.ConstraintGreaterEquals:
-		sorted := getSorted()
-		for i := len(sorted) - 1; i >= 0; i-- {
-			if sorted[i].GreaterThan(v) || sorted[i].Equal(v) {
-				return pkgs[sorted[i]], nil
+// chosen returns the package chosen to satisfy req, which is declared by a
+// package of the given architecture. A set of alternatives which is still
+// being resolved has no choice recorded, so the choice of its alternative
+// being tried is returned.
+func (c *coveredDeps) chosen(req deb.Requirement, arch string) (chosenPackage, bool) {
+	if chosen, ok := c.choices[requirementKey{relation: req.String(), arch: arch}]; ok {
+		return chosen, true
+	}
+	if req.Kind == deb.OrCompositeRequirement {
+		for _, alt := range req.Children {
+			if chosen, ok := c.chosen(alt, arch); ok && chosen.name != "" {
+				return chosen, true
 			}
 		}
+	}
+	return chosenPackage{}, false
+}
 
-	case deb.ConstraintLessThanEquals:
-		sorted := getSorted()
-		for i := len(sorted) - 1; i >= 0; i-- {
-			if sorted[i].LessThan(v) || sorted[i].Equal(v) {
-				return pkgs[sorted[i]], nil
+// dependencyEdges returns the edges from the named package to the packages
+// chosen to satisfy its Pre-Depends and Depends, which are resolved for the
+// given architecture.
+func (c *coveredDeps) dependencyEdges(name string, v version.Version, arch string, preDeps, deps deb.Requirement) []DependencyEdge {
+	var out []DependencyEdge
+	for _, field := range []struct {
+		name string
+		rel  deb.Requirement
+	}{{"Pre-Depends", preDeps}, {"Depends", deps}} {
+		for _, group := range relationGroups(field.rel) {
+			chosen, ok := c.chosen(group, arch)
+			if !ok || chosen.name == "" || (chosen.name == name && chosen.version.Equal(v)) {
+				continue
 			}
+			out = append(out, DependencyEdge{
+				From:        name,
+				FromVersion: v,
+				To:          chosen.name,
+				ToVersion:   chosen.version,
+				Field:       field.name,
+				Relation:    group,
+			})
 		}
 	}
-
-	return nil, os.ErrNotExist
+	return out
 }
 
-// checkSetCoveredDependency returns true if that requirement has already been satisfied.
+// checkSetCoveredDependency returns true if that requirement has already been
+// satisfied for a package of the given architecture.
 // If the requirement has not been satisfied, it is added to coveredDeps.
-func checkSetCoveredDependency(coveredDeps *coveredDeps, req deb.Requirement) bool {
-	for _, covered := range coveredDeps.Requirements {
-		if covered.Equal(&req) {
-			return true
-		}
+func checkSetCoveredDependency(coveredDeps *coveredDeps, req deb.Requirement, arch string) bool {
+	key := requirementKey{relation: req.String(), arch: arch}
+	if coveredDeps.requirements[key] {
+		return true
+	}
+	if coveredDeps.requirements == nil {
+		coveredDeps.requirements = map[requirementKey]bool{}
 	}
-	coveredDeps.Requirements = append(coveredDeps.Requirements, req)
+	coveredDeps.requirements[key] = true
+	coveredDeps.requirementLog = append(coveredDeps.requirementLog, key)
 	return false
 }
 
 // checkSetCoveredPackage returns true if that package+version has already been
 // satisfied in the install graph.
 // If the requirement has not been satisfied, it is added to coveredDeps.
-func checkSetCoveredPackage(coveredDeps *coveredDeps, pkg, version string, virtualProvides []string) bool {
-	for _, covered := range coveredDeps.Packages {
-		if covered.Name == pkg && covered.Version == version {
-			return true
-		}
-	}
-	coveredDeps.Packages = append(coveredDeps.Packages, struct {
-		Name            string
-		Version         string
-		VirtualProvides []string
-	}{
-		Name:            pkg,
-		Version:         version,
-		VirtualProvides: virtualProvides,
-	})
+func checkSetCoveredPackage(coveredDeps *coveredDeps, pkg, version, arch string) bool {
+	key := packageKey{name: pkg, version: version, arch: arch}
+	if coveredDeps.packages[key] {
+		return true
+	}
+	if coveredDeps.packages == nil {
+		coveredDeps.packages = map[packageKey]bool{}
+	}
+	coveredDeps.packages[key] = true
+	coveredDeps.packageLog = append(coveredDeps.packageLog, key)
 	return false
 }
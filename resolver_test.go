@@ -1,6 +1,13 @@
 package debdep
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/twitchyliquid64/debdep/deb"
@@ -259,3 +266,431 @@ func TestInstallGraphUnsatisfiedNoVersion(t *testing.T) {
 		t.Errorf("Error parameters incorrect, got %v", info)
 	}
 }
+
+func TestInstallGraphUnsatisfiedChain(t *testing.T) {
+	pkgInfo := &PackageInfo{
+		BinaryPackages: true,
+		Packages: map[string]map[version.Version]*deb.Paragraph{
+			"base":     makePkg(t, "base", []string{"1.3.2"}, "kek"),
+			"kek":      makePkg(t, "kek", []string{"1.0"}, "meep | yolo"),
+			"meep":     makePkg(t, "meep", []string{"1.0", "1.5"}, "swaggins (>> 2.0)"),
+			"swaggins": makePkg(t, "swaggins", []string{"1.1", "1.9"}, ""),
+		},
+	}
+
+	_, err := pkgInfo.InstallGraph("base", &PackageInfo{})
+	info, ok := err.(ErrDependency)
+	if !ok {
+		t.Fatalf("error was not type ErrDependency, got %v", err)
+	}
+	if info.RequiredByPackage != "kek" || info.RequiredByVersion != "1.0" || len(info.Alternatives) != 2 {
+		t.Fatalf("Error parameters incorrect, got %+v", info)
+	}
+	if got, want := info.Relation.String(), "meep | yolo"; got != want {
+		t.Errorf("Relation = %q, want %q", got, want)
+	}
+
+	meepErr := info.Alternatives[0]
+	if meepErr.DependencyPackage != "swaggins" || meepErr.RequiredByPackage != "meep" || meepErr.RequiredByVersion != "1.5" {
+		t.Errorf("First alternative incorrect, got %+v", meepErr)
+	}
+	if !reflect.DeepEqual(meepErr.Rejected, []string{"1.1", "1.9"}) {
+		t.Errorf("Rejected = %v, want [1.1 1.9]", meepErr.Rejected)
+	}
+	var chain []string
+	for _, link := range meepErr.Chain {
+		chain = append(chain, link.String())
+	}
+	if want := []string{"base (1.3.2) Depends: kek", "kek (1.0) Depends: meep | yolo", "meep (1.5) Depends: swaggins (>> 2.0)"}; !reflect.DeepEqual(chain, want) {
+		t.Errorf("Chain = %q, want %q", chain, want)
+	}
+	if yoloErr := info.Alternatives[1]; yoloErr.DependencyPackage != "yolo" || yoloErr.RequiredByPackage != "kek" {
+		t.Errorf("Second alternative incorrect, got %+v", yoloErr)
+	}
+}
+
+func TestErrDependencyTopLevelAlternatives(t *testing.T) {
+	rel, err := deb.ParsePackageRelations("a | b", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := ErrDependency{
+		Relation: rel,
+		Alternatives: []ErrDependency{
+			{DependencyPackage: "a"},
+			{DependencyPackage: "b"},
+		},
+	}
+	want := `required "a | b", but no alternative could be satisfied (required package "a" was not found; required package "b" was not found)`
+	if got := e.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestInstallGraphMulti(t *testing.T) {
+	pkgInfo := &PackageInfo{
+		BinaryPackages: true,
+		Packages: map[string]map[version.Version]*deb.Paragraph{
+			"base": makePkg(t, "base", []string{"1.3.2", "1.9.2"}, "kek"),
+			"meep": makePkg(t, "meep", []string{"1.0", "2.0"}, "kek, yolo"),
+			"kek":  makePkg(t, "kek", []string{"1.3.2"}, ""),
+			"yolo": makePkg(t, "yolo", []string{"1"}, ""),
+		},
+	}
+	installed := &PackageInfo{}
+	installed.AddPkg(&deb.Paragraph{Values: map[string]string{"Package": "yolo", "Version": "1"}})
+
+	graph, err := pkgInfo.InstallGraphMulti([]string{"base=1.3.2", "meep (<< 2.0)", "yolo"}, installed, ResolveOptions{})
+	if err != nil {
+		t.Fatalf("InstallGraphMulti() returned err: %v", err)
+	}
+
+	var got []string
+	for _, op := range graph.Unroll() {
+		got = append(got, op.Package+"="+op.Version.String())
+	}
+	if want := []string{"kek=1.3.2", "base=1.3.2", "meep=1.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unroll() = %v, want %v", got, want)
+	}
+	if len(installed.Packages) != 1 {
+		t.Errorf("installed was modified, got %d packages", len(installed.Packages))
+	}
+}
+
+func TestInstallGraphNotInstalled(t *testing.T) {
+	pkgInfo := &PackageInfo{
+		BinaryPackages: true,
+		Packages: map[string]map[version.Version]*deb.Paragraph{
+			"app":  makePkg(t, "app", []string{"2"}, "lib, conf"),
+			"lib":  makePkg(t, "lib", []string{"1"}, ""),
+			"conf": makePkg(t, "conf", []string{"1"}, ""),
+		},
+	}
+	installed := &PackageInfo{}
+	installed.AddPkg(&deb.Paragraph{Values: map[string]string{"Package": "lib", "Version": "1", "Status": "deinstall ok config-files"}})
+	installed.AddPkg(&deb.Paragraph{Values: map[string]string{"Package": "conf", "Version": "1", "Status": "purge ok not-installed"}})
+
+	graph, err := pkgInfo.InstallGraph("app", installed)
+	if err != nil {
+		t.Fatalf("InstallGraph() returned err: %v", err)
+	}
+	var got []string
+	for _, op := range graph.Unroll() {
+		got = append(got, op.Package)
+	}
+	if want := []string{"lib", "conf", "app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unroll() = %v, want %v", got, want)
+	}
+}
+
+func TestInstallGraphEssential(t *testing.T) {
+	pkgInfo := &PackageInfo{
+		BinaryPackages: true,
+		Packages: map[string]map[version.Version]*deb.Paragraph{
+			"app":       makePkg(t, "app", []string{"1.0"}, "libc"),
+			"libc":      makePkg(t, "libc", []string{"2.28"}, ""),
+			"dash":      makePkg(t, "dash", []string{"0.5"}, "libc"),
+			"coreutils": makePkg(t, "coreutils", []string{"8.30"}, ""),
+		},
+	}
+	for _, name := range []string{"dash", "coreutils"} {
+		for _, p := range pkgInfo.Packages[name] {
+			p.Values["Essential"] = "yes"
+		}
+	}
+
+	graph, err := pkgInfo.InstallGraphMulti([]string{"app"}, nil, ResolveOptions{Essential: true})
+	if err != nil {
+		t.Fatalf("InstallGraphMulti() returned err: %v", err)
+	}
+	var got []string
+	for _, op := range graph.Unroll() {
+		got = append(got, op.Package)
+	}
+	if want := []string{"coreutils", "libc", "dash", "app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unroll() = %v, want %v", got, want)
+	}
+
+	// The single-target API applies the same pre-pass.
+	graph, err = pkgInfo.InstallGraphContext(context.Background(), "app", nil, ResolveOptions{Essential: true})
+	if err != nil {
+		t.Fatalf("InstallGraphContext() returned err: %v", err)
+	}
+	got = nil
+	for _, op := range graph.Unroll() {
+		got = append(got, op.Package)
+	}
+	if want := []string{"coreutils", "libc", "dash", "app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallGraphContext() Unroll() = %v, want %v", got, want)
+	}
+
+	// Essential packages which are installed are not installed again.
+	installed := &PackageInfo{
+		Packages: map[string]map[version.Version]*deb.Paragraph{
+			"dash": makePkg(t, "dash", []string{"0.5"}, ""),
+		},
+	}
+	graph, err = pkgInfo.InstallGraphMulti([]string{"app"}, installed, ResolveOptions{Essential: true})
+	if err != nil {
+		t.Fatalf("InstallGraphMulti() returned err: %v", err)
+	}
+	got = nil
+	for _, op := range graph.Unroll() {
+		got = append(got, op.Package)
+	}
+	if want := []string{"coreutils", "libc", "app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unroll() = %v, want %v", got, want)
+	}
+}
+
+func TestParseTargetSpec(t *testing.T) {
+	tcs := []struct {
+		spec string
+		want string
+	}{
+		{"foo", "foo"},
+		{"foo=1.2-3", "foo (= 1.2-3)"},
+		{"foo (>= 2.0)", "foo (>= 2.0)"},
+		{"foo | bar (<< 1)", "foo | bar (<< 1)"},
+	}
+	for _, tc := range tcs {
+		req, err := ParseTargetSpec(tc.spec)
+		if err != nil {
+			t.Errorf("ParseTargetSpec(%q) returned err: %v", tc.spec, err)
+			continue
+		}
+		if got := req.String(); got != tc.want {
+			t.Errorf("ParseTargetSpec(%q) = %q, want %q", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestInstallGraphPreferSatisfiedAlternative(t *testing.T) {
+	pkgs := makePkgInfo(t,
+		map[string]string{"Package": "app", "Version": "1", "Depends": "default-mta | mail-transport-agent"},
+		map[string]string{"Package": "default-mta", "Version": "1", "Depends": "exim4"},
+		map[string]string{"Package": "exim4", "Version": "1", "Provides": "mail-transport-agent"},
+		map[string]string{"Package": "postfix", "Version": "1", "Provides": "mail-transport-agent"},
+		map[string]string{"Package": "tool", "Version": "1", "Depends": "gawk | mawk"},
+		map[string]string{"Package": "gawk", "Version": "1"},
+		map[string]string{"Package": "mawk", "Version": "1"},
+	)
+
+	tcs := []struct {
+		name      string
+		targets   []string
+		installed *PackageInfo
+		want      []string
+	}{
+		{
+			name:      "first alternative",
+			targets:   []string{"tool"},
+			installed: &PackageInfo{},
+			want:      []string{"gawk", "tool"},
+		},
+		{
+			name:      "installed alternative",
+			targets:   []string{"tool"},
+			installed: makePkgInfo(t, map[string]string{"Package": "mawk", "Version": "1"}),
+			want:      []string{"tool"},
+		},
+		{
+			name:      "installed provider",
+			targets:   []string{"app"},
+			installed: makePkgInfo(t, map[string]string{"Package": "postfix", "Version": "1", "Provides": "mail-transport-agent"}),
+			want:      []string{"app"},
+		},
+		{
+			name:      "alternative already in graph",
+			targets:   []string{"mawk", "tool"},
+			installed: &PackageInfo{},
+			want:      []string{"mawk", "tool"},
+		},
+		{
+			name:      "provider already in graph",
+			targets:   []string{"postfix", "app"},
+			installed: &PackageInfo{},
+			want:      []string{"postfix", "app"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			graph, err := pkgs.InstallGraphMulti(tc.targets, tc.installed, ResolveOptions{})
+			if err != nil {
+				t.Fatalf("InstallGraphMulti(%v) returned err: %v", tc.targets, err)
+			}
+			if got := graphPackageNames(t, graph); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("InstallGraphMulti(%v) = %v, want %v", tc.targets, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSplitTargetSpecs(t *testing.T) {
+	tcs := []struct {
+		in   string
+		want []string
+	}{
+		{"screen vim", []string{"screen", "vim"}},
+		{"libc6 (>= 2.36) foo=1.2-3", []string{"libc6 (>= 2.36)", "foo=1.2-3"}},
+		{"foo | bar  libc6:i386", []string{"foo | bar", "libc6:i386"}},
+		{"a (<< 2), b |c,d", []string{"a (<< 2)", "b |c", "d"}},
+		{"  ", nil},
+	}
+	for _, tc := range tcs {
+		if got := SplitTargetSpecs(tc.in); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("SplitTargetSpecs(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestInstallGraphTargetSpec(t *testing.T) {
+	pkgs := makePkgInfo(t,
+		map[string]string{"Package": "app", "Version": "1", "Depends": "old-lib"},
+		map[string]string{"Package": "app", "Version": "2"},
+	)
+	graph, err := pkgs.InstallGraph("app=1", &PackageInfo{})
+	if err == nil {
+		t.Fatalf("InstallGraph(app=1) = %v, want error for missing old-lib", graph.Unroll())
+	}
+	var depErr ErrDependency
+	if !errors.As(err, &depErr) || depErr.Relation.Package != "old-lib" {
+		t.Errorf("InstallGraph(app=1) returned %v, want unsatisfied old-lib", err)
+	}
+
+	graph, err = pkgs.InstallGraph("app (>= 2)", &PackageInfo{})
+	if err != nil {
+		t.Fatalf("InstallGraph(app (>= 2)) failed: %v", err)
+	}
+	if ops := graph.Unroll(); len(ops) != 1 || ops[0].Version.String() != "2" {
+		t.Errorf("InstallGraph(app (>= 2)) = %v, want app 2", ops)
+	}
+	if _, err := pkgs.InstallGraph("app (>= 3)", &PackageInfo{}); err == nil {
+		t.Error("InstallGraph(app (>= 3)) succeeded, want error")
+	}
+}
+
+// syntheticArchive builds an archive resembling a Debian Packages index:
+// packages depend on a handful of lower-numbered packages, with versioned
+// relations, alternatives and virtual packages mixed in, and occasional
+// dependency loops.
+func syntheticArchive(b testing.TB, size int) *PackageInfo {
+	b.Helper()
+	rng := rand.New(rand.NewSource(1))
+	out := &PackageInfo{BinaryPackages: true}
+	for i := 0; i < size; i++ {
+		values := map[string]string{
+			"Package":      fmt.Sprintf("pkg%d", i),
+			"Version":      fmt.Sprintf("1.%d-1", rng.Intn(10)),
+			"Architecture": "amd64",
+			"Priority":     "optional",
+		}
+		if i%10 == 0 {
+			values["Priority"] = "important"
+		}
+		if i%50 == 0 {
+			values["Provides"] = fmt.Sprintf("virtual%d", i/50)
+		}
+
+		var deps []string
+		for j := 0; j < 1+rng.Intn(6) && i > 0; j++ {
+			dep := fmt.Sprintf("pkg%d", rng.Intn(i))
+			switch rng.Intn(6) {
+			case 0:
+				dep += " (>= 1.0)"
+			case 1:
+				dep += fmt.Sprintf(" | pkg%d", rng.Intn(i))
+			case 2:
+				if i >= 50 {
+					dep = fmt.Sprintf("virtual%d", rng.Intn(i/50))
+				}
+			}
+			deps = append(deps, dep)
+		}
+		if i > 100 && i+10 < size && rng.Intn(20) == 0 {
+			// Loop back to a package depending on this one.
+			deps = append(deps, fmt.Sprintf("pkg%d", i+1+rng.Intn(10)))
+		}
+		values["Depends"] = strings.Join(deps, ", ")
+
+		if err := out.AddPkg(&deb.Paragraph{Values: values}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return out
+}
+
+func TestDeterministicOutput(t *testing.T) {
+	archive := syntheticArchive(t, 2000)
+
+	var want []string
+	for run := 0; run < 5; run++ {
+		// Merging iterates over the packages of the archive, so providers
+		// of virtual packages must not be recorded in map order.
+		pkgs := &PackageInfo{BinaryPackages: true}
+		if err := pkgs.Merge(archive); err != nil {
+			t.Fatal(err)
+		}
+		targets := pkgs.GetAllByPriority("important")
+		got := append([]string{}, targets...)
+		graph, err := pkgs.InstallGraphMulti(targets, &PackageInfo{}, ResolveOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, op := range graph.Unroll() {
+			got = append(got, op.Package+" "+op.Version.String())
+		}
+
+		if !sort.StringsAreSorted(targets) {
+			t.Errorf("GetAllByPriority() = %v, want sorted", targets)
+		}
+		if run == 0 {
+			want = got
+		} else if !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d produced different output to the first run", run)
+		}
+	}
+}
+
+func TestProviderTieBreak(t *testing.T) {
+	providers := []map[string]string{
+		{"Package": "b", "Version": "1", "Provides": "v"},
+		{"Package": "a", "Version": "1", "Provides": "v"},
+	}
+	for _, order := range [][]int{{0, 1}, {1, 0}} {
+		pkgs := makePkgInfo(t,
+			map[string]string{"Package": "x", "Version": "1", "Depends": "v"},
+			providers[order[0]],
+			providers[order[1]],
+		)
+		graph, err := pkgs.InstallGraph("x", &PackageInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops := graph.Unroll()
+		if len(ops) != 2 || ops[0].Package != "a" {
+			t.Errorf("with providers in order %v, InstallGraph() = %v, want a to provide v", order, ops)
+		}
+	}
+}
+
+func BenchmarkInstallGraph(b *testing.B) {
+	pkgs := syntheticArchive(b, 20000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := pkgs.InstallGraph("pkg19999", &PackageInfo{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInstallGraphMulti(b *testing.B) {
+	pkgs := syntheticArchive(b, 20000)
+	targets := pkgs.GetAllByPriority("important")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := pkgs.InstallGraphMulti(targets, nil, ResolveOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
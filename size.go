@@ -0,0 +1,129 @@
+package debdep
+
+import (
+	"context"
+
+	"github.com/twitchyliquid64/debdep/deb"
+
+	version "github.com/knqyf263/go-deb-version"
+)
+
+// PackageSize describes the space used by a package.
+type PackageSize struct {
+	Package string
+	Version version.Version
+
+	// InstalledSize and DownloadSize are the installed size and package
+	// file size, in bytes.
+	InstalledSize int64
+	DownloadSize  int64
+}
+
+// InstallSize describes the space needed by the packages in an install
+// graph.
+type InstallSize struct {
+	// Packages lists the size of each package, in the order of the graph.
+	Packages []PackageSize
+
+	// InstalledSize and DownloadSize are the totals of the packages, in
+	// bytes.
+	InstalledSize int64
+	DownloadSize  int64
+}
+
+// TargetSize describes the packages which are only needed by one of a set
+// of targets, and so would not be installed if that target was dropped.
+type TargetSize struct {
+	Target string
+	// Packages lists the packages exclusive to the target, including the
+	// target itself, in the order of the install graph.
+	Packages []string
+
+	// InstalledSize and DownloadSize are the totals of the exclusive
+	// packages, in bytes.
+	InstalledSize int64
+	DownloadSize  int64
+}
+
+// packageSizes returns the installed size and package file size of pkg.
+func packageSizes(pkg *deb.Paragraph) (int64, int64, error) {
+	installed, err := pkg.InstalledSize()
+	if err != nil {
+		return 0, 0, err
+	}
+	download, err := pkg.Size()
+	if err != nil {
+		return 0, 0, err
+	}
+	return installed, download, nil
+}
+
+// GraphSize computes the space needed by the packages in the install
+// graph. Packages which are already installed are not part of the graph,
+// so are not counted.
+func (p *PackageInfo) GraphSize(graph *Operation) (*InstallSize, error) {
+	pkgs, err := graphPackages(p, graph)
+	if err != nil {
+		return nil, err
+	}
+	out := &InstallSize{}
+	for _, op := range graph.Unroll() {
+		installed, download, err := packageSizes(pkgs[op.Package])
+		if err != nil {
+			return nil, err
+		}
+		out.Packages = append(out.Packages, PackageSize{
+			Package:       op.Package,
+			Version:       op.Version,
+			InstalledSize: installed,
+			DownloadSize:  download,
+		})
+		out.InstalledSize += installed
+		out.DownloadSize += download
+	}
+	return out, nil
+}
+
+// ExclusiveSizes computes, for each of the targets, the packages which
+// would no longer be installed if that target was dropped, and the space
+// they use. graph is the install graph of all of the targets, as returned
+// by InstallGraphMulti with the same arguments, and the targets are
+// resolved again without each target in turn.
+func (p *PackageInfo) ExclusiveSizes(graph *Operation, targets []string, installed *PackageInfo, opts ResolveOptions) ([]TargetSize, error) {
+	return p.ExclusiveSizesContext(context.Background(), graph, targets, installed, opts)
+}
+
+// ExclusiveSizesContext is like ExclusiveSizes, but resolution is abandoned
+// with an ErrLimit if ctx is done or a limit set in opts is exceeded.
+func (p *PackageInfo) ExclusiveSizesContext(ctx context.Context, graph *Operation, targets []string, installed *PackageInfo, opts ResolveOptions) ([]TargetSize, error) {
+	sizes, err := p.GraphSize(graph)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]TargetSize, len(targets))
+	for i, target := range targets {
+		others := make([]string, 0, len(targets)-1)
+		others = append(others, targets[:i]...)
+		others = append(others, targets[i+1:]...)
+		without, err := p.InstallGraphMultiContext(ctx, others, installed, opts)
+		if err != nil {
+			return nil, err
+		}
+		remaining := map[string]bool{}
+		for _, op := range without.Unroll() {
+			remaining[op.Package+" "+op.Version.String()] = true
+		}
+
+		out[i].Target = target
+		for _, s := range sizes.Packages {
+			if remaining[s.Package+" "+s.Version.String()] {
+				continue
+			}
+			out[i].Packages = append(out[i].Packages, s.Package)
+			out[i].InstalledSize += s.InstalledSize
+			out[i].DownloadSize += s.DownloadSize
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,62 @@
+package debdep
+
+import (
+	"reflect"
+	"testing"
+)
+
+func sizeTestPkgs(t *testing.T) *PackageInfo {
+	t.Helper()
+	return makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "1", "Depends": "shared, x", "Installed-Size": "10", "Size": "100"},
+		map[string]string{"Package": "b", "Version": "1", "Depends": "shared", "Installed-Size": "20", "Size": "200"},
+		map[string]string{"Package": "shared", "Version": "1", "Installed-Size": "1000", "Size": "10000"},
+		map[string]string{"Package": "x", "Version": "1", "Installed-Size": "5"},
+	)
+}
+
+func TestGraphSize(t *testing.T) {
+	pkgs := sizeTestPkgs(t)
+	graph, err := pkgs.InstallGraph("a", &PackageInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := pkgs.GraphSize(graph)
+	if err != nil {
+		t.Fatalf("GraphSize() failed: %v", err)
+	}
+
+	var got []string
+	for _, s := range size.Packages {
+		got = append(got, s.Package)
+	}
+	if want := []string{"shared", "x", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Packages = %v, want %v", got, want)
+	}
+	if want := int64((1000 + 5 + 10) * 1024); size.InstalledSize != want {
+		t.Errorf("InstalledSize = %d, want %d", size.InstalledSize, want)
+	}
+	if want := int64(10000 + 100); size.DownloadSize != want {
+		t.Errorf("DownloadSize = %d, want %d", size.DownloadSize, want)
+	}
+}
+
+func TestExclusiveSizes(t *testing.T) {
+	pkgs := sizeTestPkgs(t)
+	targets := []string{"a", "b"}
+	graph, err := pkgs.InstallGraphMulti(targets, &PackageInfo{}, ResolveOptions{})
+	if err != nil {
+		t.Fatalf("InstallGraphMulti() failed: %v", err)
+	}
+	got, err := pkgs.ExclusiveSizes(graph, targets, &PackageInfo{}, ResolveOptions{})
+	if err != nil {
+		t.Fatalf("ExclusiveSizes() failed: %v", err)
+	}
+	want := []TargetSize{
+		{Target: "a", Packages: []string{"x", "a"}, InstalledSize: 15 * 1024, DownloadSize: 100},
+		{Target: "b", Packages: []string{"b"}, InstalledSize: 20 * 1024, DownloadSize: 200},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExclusiveSizes() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,212 @@
+package debdep
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/twitchyliquid64/debdep/deb"
+
+	version "github.com/knqyf263/go-deb-version"
+)
+
+// Upgrade describes an installed package which will be replaced by a
+// newer version.
+type Upgrade struct {
+	Package string
+	From    version.Version
+	To      version.Version
+}
+
+// Removal describes an installed package which must be removed.
+type Removal struct {
+	Package string
+	Version version.Version
+	Reason  string
+}
+
+// UpgradePlan describes the changes necessary to upgrade a system.
+type UpgradePlan struct {
+	Upgrades []Upgrade
+	// New lists packages which are not installed, but are needed by
+	// upgraded packages.
+	New      []Operation
+	Removals []Removal
+	// KeptBack describes why packages with newer versions available
+	// could not be upgraded.
+	KeptBack []ErrDependency
+
+	// Operations lists the removals and installs to perform, in order.
+	Operations []Operation
+}
+
+// PlanUpgrade computes the changes necessary to upgrade the installed
+// packages to their candidate versions, similar to apt full-upgrade.
+// Installed packages which are broken by, or conflict with, the upgraded
+// packages are removed, along with anything which depends on them.
+func (p *PackageInfo) PlanUpgrade(installed *PackageInfo, opts ResolveOptions) (*UpgradePlan, error) {
+	return p.PlanUpgradeContext(context.Background(), installed, opts)
+}
+
+// PlanUpgradeContext is like PlanUpgrade, but resolution is abandoned with
+// an ErrLimit if ctx is done or a limit set in opts is exceeded.
+func (p *PackageInfo) PlanUpgradeContext(ctx context.Context, installed *PackageInfo, opts ResolveOptions) (*UpgradePlan, error) {
+	current, err := installedSet(installed)
+	if err != nil {
+		return nil, err
+	}
+	if installed == nil {
+		installed = &PackageInfo{}
+	}
+
+	var plan UpgradePlan
+	state, cancel := newResolveState(ctx, installed, opts)
+	defer cancel()
+	graph := &Operation{Kind: CompositeDependencyOp}
+	for _, name := range current.names() {
+		oldVers, err := current.pkgs[name].Version()
+		if err != nil {
+			return nil, err
+		}
+		candidate, err := p.FindCandidate(name)
+		if err != nil {
+			if err == os.ErrNotExist {
+				continue // Not available from the repository.
+			}
+			return nil, err
+		}
+		// As with apt, the installed version is kept over candidates
+		// with a lower priority than installed packages.
+		if p.Priority(candidate) < InstalledPriority {
+			continue
+		}
+		newVers, err := candidate.Version()
+		if err != nil {
+			return nil, err
+		}
+		if !newVers.GreaterThan(oldVers) {
+			continue
+		}
+
+		req := deb.Requirement{
+			Kind:    deb.PackageRelationRequirement,
+			Package: candidate.Name(),
+			VersionConstraint: &deb.VersionConstraint{
+				ConstraintRelation: deb.ConstraintEquals,
+				Version:            newVers.String(),
+			},
+		}
+		if name != candidate.Name() {
+			// Upgrade the package of the same foreign architecture.
+			req.ArchConstraint = deb.Arch{Arch: candidate.Arch()}
+		}
+		mark := state.covered.mark()
+		op, err := p.buildInstallGraphRequirement(state, req, "", nil, false)
+		if err != nil {
+			if depErr, wasDep := err.(ErrDependency); wasDep {
+				state.covered.reset(mark)
+				plan.KeptBack = append(plan.KeptBack, depErr)
+				continue
+			}
+			return nil, err
+		}
+		graph.DependentOperations = append(graph.DependentOperations, op)
+	}
+
+	// Compute the set of packages which would be present after the upgrade.
+	final, err := installedSet(installed)
+	if err != nil {
+		return nil, err
+	}
+	changed := map[string]bool{}
+	installOps := graph.Unroll()
+	for _, op := range installOps {
+		pkg, ok := p.Packages[op.Package][op.Version]
+		if !ok {
+			return nil, fmt.Errorf("package %q (%s) not present in package info", op.Package, op.Version.String())
+		}
+		changed[op.Package] = true
+		final.add(pkg)
+
+		if old, wasInstalled := current.pkgs[op.Package]; wasInstalled {
+			oldVers, err := old.Version()
+			if err != nil {
+				return nil, err
+			}
+			plan.Upgrades = append(plan.Upgrades, Upgrade{Package: op.Package, From: oldVers, To: op.Version})
+		} else {
+			plan.New = append(plan.New, op)
+		}
+	}
+
+	// Remove installed packages which are broken by, or conflict with,
+	// the packages being installed.
+	removed := map[string]bool{}
+	removeInstalled := func(name, reason string) error {
+		if removed[name] {
+			return nil
+		}
+		if listed(state.held, current.pkgs[name]) {
+			return fmt.Errorf("cannot upgrade: held package %s would be removed (%s)", name, reason)
+		}
+		v, err := current.pkgs[name].Version()
+		if err != nil {
+			return err
+		}
+		removed[name] = true
+		plan.Removals = append(plan.Removals, Removal{Package: name, Version: v, Reason: reason})
+		return nil
+	}
+	for _, name := range final.names() {
+		violations, err := final.violations(final.pkgs[name])
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range violations {
+			reason := fmt.Sprintf("%s %s: %s", v.Package, v.Field, v.Relation.String())
+			switch {
+			case !changed[v.Victim]:
+				err = removeInstalled(v.Victim, reason)
+			case !changed[v.Package]:
+				err = removeInstalled(v.Package, reason)
+			default:
+				err = fmt.Errorf("cannot upgrade: %s, and both are to be installed", reason)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	for name := range removed {
+		final.remove(name)
+	}
+
+	// Removing packages may in turn break packages which depend on them.
+	// Packages which were broken before the upgrade are left alone.
+	ignore, err := current.alreadyBroken()
+	if err != nil {
+		return nil, err
+	}
+	cascade, err := final.removeBroken(ignore)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range cascade {
+		if changed[b.Package] {
+			return nil, fmt.Errorf("cannot upgrade: %s would not be satisfied", b.String())
+		}
+		if err := removeInstalled(b.Package, b.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range plan.Removals {
+		plan.Operations = append(plan.Operations, Operation{
+			Kind:    DebPackageRemoveOp,
+			Package: r.Package,
+			Version: r.Version,
+		})
+	}
+	plan.Operations = append(plan.Operations, installOps...)
+	return &plan, nil
+}
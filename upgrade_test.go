@@ -0,0 +1,119 @@
+package debdep
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/twitchyliquid64/debdep/deb"
+)
+
+func makePkgInfo(t *testing.T, pkgs ...map[string]string) *PackageInfo {
+	t.Helper()
+	return makeConfiguredPkgInfo(t, ResolverConfig{}, pkgs...)
+}
+
+// makeConfiguredPkgInfo is like makePkgInfo, but the packages are added
+// under the given configuration, such as for multiarch tests.
+func makeConfiguredPkgInfo(t *testing.T, conf ResolverConfig, pkgs ...map[string]string) *PackageInfo {
+	t.Helper()
+	out := &PackageInfo{BinaryPackages: true, Config: conf}
+	for _, values := range pkgs {
+		if err := out.AddPkg(&deb.Paragraph{Values: values}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out
+}
+
+func TestPlanUpgrade(t *testing.T) {
+	installed := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "1", "Depends": "b"},
+		map[string]string{"Package": "b", "Version": "1"},
+		map[string]string{"Package": "c", "Version": "1"},
+		map[string]string{"Package": "d", "Version": "1", "Depends": "c"},
+		map[string]string{"Package": "e", "Version": "1", "Status": "deinstall ok config-files"},
+	)
+	repo := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "2", "Depends": "b (>= 2), n"},
+		map[string]string{"Package": "b", "Version": "2", "Breaks": "c (<< 5)"},
+		map[string]string{"Package": "c", "Version": "1"},
+		map[string]string{"Package": "e", "Version": "2"},
+		map[string]string{"Package": "n", "Version": "1"},
+	)
+
+	plan, err := repo.PlanUpgrade(installed, ResolveOptions{})
+	if err != nil {
+		t.Fatalf("PlanUpgrade() returned err: %v", err)
+	}
+
+	var upgrades []string
+	for _, u := range plan.Upgrades {
+		upgrades = append(upgrades, u.Package+" "+u.From.String()+"->"+u.To.String())
+	}
+	if want := []string{"b 1->2", "a 1->2"}; !reflect.DeepEqual(upgrades, want) {
+		t.Errorf("Upgrades = %v, want %v", upgrades, want)
+	}
+	if len(plan.New) != 1 || plan.New[0].Package != "n" {
+		t.Errorf("New = %+v, want [n]", plan.New)
+	}
+	var removals []string
+	for _, r := range plan.Removals {
+		removals = append(removals, r.Package+": "+r.Reason)
+	}
+	if want := []string{"c: b Breaks: c (<< 5)", "d: d Depends: c"}; !reflect.DeepEqual(removals, want) {
+		t.Errorf("Removals = %q, want %q", removals, want)
+	}
+
+	var ops []string
+	for _, op := range plan.Operations {
+		ops = append(ops, op.Kind.String()+" "+op.Package)
+	}
+	want := []string{"package-remove c", "package-remove d", "package-dep b", "package-dep n", "package-dep a"}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("Operations = %v, want %v", ops, want)
+	}
+}
+
+func TestPlanUpgradeKeptBack(t *testing.T) {
+	installed := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "1"},
+		map[string]string{"Package": "b", "Version": "1"},
+	)
+	repo := makePkgInfo(t,
+		map[string]string{"Package": "a", "Version": "2", "Depends": "missing"},
+		map[string]string{"Package": "b", "Version": "2"},
+	)
+
+	plan, err := repo.PlanUpgrade(installed, ResolveOptions{})
+	if err != nil {
+		t.Fatalf("PlanUpgrade() returned err: %v", err)
+	}
+	if len(plan.KeptBack) != 1 || plan.KeptBack[0].DependencyPackage != "missing" {
+		t.Errorf("KeptBack = %+v, want failure for missing", plan.KeptBack)
+	}
+	if len(plan.Upgrades) != 1 || plan.Upgrades[0].Package != "b" {
+		t.Errorf("Upgrades = %+v, want [b]", plan.Upgrades)
+	}
+}
+
+func TestPlanUpgradeConfigFiles(t *testing.T) {
+	installed := makePkgInfo(t,
+		map[string]string{"Package": "app", "Version": "1"},
+		map[string]string{"Package": "lib", "Version": "1", "Status": "deinstall ok config-files"},
+	)
+	repo := makePkgInfo(t,
+		map[string]string{"Package": "app", "Version": "2", "Depends": "lib"},
+		map[string]string{"Package": "lib", "Version": "1"},
+	)
+
+	plan, err := repo.PlanUpgrade(installed, ResolveOptions{})
+	if err != nil {
+		t.Fatalf("PlanUpgrade() returned err: %v", err)
+	}
+	if len(plan.Upgrades) != 1 || plan.Upgrades[0].Package != "app" {
+		t.Errorf("Upgrades = %+v, want [app]", plan.Upgrades)
+	}
+	if len(plan.New) != 1 || plan.New[0].Package != "lib" {
+		t.Errorf("New = %+v, want [lib]", plan.New)
+	}
+}
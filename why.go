@@ -0,0 +1,216 @@
+package debdep
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/twitchyliquid64/debdep/deb"
+
+	version "github.com/knqyf263/go-deb-version"
+)
+
+// maxWhyChains bounds the number of chains returned by WhyInstalled, as
+// densely-connected graphs can have a very large number of shortest paths.
+const maxWhyChains = 32
+
+// DependencyEdge describes a package in an install set which is required
+// by another package in that install set.
+type DependencyEdge struct {
+	From        string
+	FromVersion version.Version
+	To          string
+	ToVersion   version.Version
+
+	// Field is the control field the relation came from, such as Depends.
+	Field string
+	// Relation is the group of alternatives which To satisfies.
+	Relation deb.Requirement
+}
+
+// WhyLink is a single step in a chain of requirements.
+type WhyLink struct {
+	Package string
+	Version version.Version
+
+	// Field and Relation describe how Package requires the next
+	// package in the chain. They are empty for the last link.
+	Field    string
+	Relation deb.Requirement
+}
+
+// String returns a human-friendly representation of the link.
+func (l WhyLink) String() string {
+	out := l.Package + " (" + l.Version.String() + ")"
+	if l.Field != "" {
+		out += " " + l.Field + ": " + l.Relation.String()
+	}
+	return out
+}
+
+// WhyChain is a chain of requirements from a target package to a
+// package in its install set.
+type WhyChain []WhyLink
+
+// String returns the chain on a single line.
+func (c WhyChain) String() string {
+	parts := make([]string, len(c))
+	for i, l := range c {
+		parts[i] = l.String()
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// relationGroups returns the top-level groups of a relation field, each of
+// which must be satisfied independently.
+func relationGroups(req deb.Requirement) []deb.Requirement {
+	if req.Kind == deb.AndCompositeRequirement {
+		return req.Children
+	}
+	return []deb.Requirement{req}
+}
+
+// InstallEdges returns the dependency edges between packages in the given
+// install graph, from each package to the packages the resolver chose to
+// satisfy its relations. Relations satisfied by packages outside of the
+// graph (such as those already installed) do not produce edges.
+func (p *PackageInfo) InstallEdges(graph *Operation) ([]DependencyEdge, error) {
+	ops := graph.Unroll()
+	inGraph := map[string]bool{}
+	for _, op := range ops {
+		if _, ok := p.Packages[op.Package][op.Version]; !ok {
+			return nil, fmt.Errorf("package %q (%s) not present in package info", op.Package, op.Version.String())
+		}
+		inGraph[op.Package+" "+op.Version.String()] = true
+	}
+
+	var out []DependencyEdge
+	for _, op := range ops {
+		for _, e := range op.Dependencies {
+			if inGraph[e.To+" "+e.ToVersion.String()] {
+				out = append(out, e)
+			}
+		}
+	}
+	return out, nil
+}
+
+// WhyInstalled returns the shortest chains of requirements which cause pkg
+// to be part of the install graph for target. An error is returned if pkg
+// is not part of the install graph.
+func (p *PackageInfo) WhyInstalled(graph *Operation, target, pkg string) ([]WhyChain, error) {
+	edges, err := p.InstallEdges(graph)
+	if err != nil {
+		return nil, err
+	}
+	versions := map[string]version.Version{}
+	for _, op := range graph.Unroll() {
+		versions[op.Package] = op.Version
+	}
+	target, ok := p.graphTarget(versions, target)
+	if !ok {
+		return nil, fmt.Errorf("target %q is not part of the install graph", target)
+	}
+	if _, ok := versions[pkg]; !ok {
+		return nil, fmt.Errorf("package %q is not required by %q", pkg, target)
+	}
+	if pkg == target {
+		return []WhyChain{{{Package: target, Version: versions[target]}}}, nil
+	}
+
+	outgoing := map[string][]DependencyEdge{}
+	for _, e := range edges {
+		outgoing[e.From] = append(outgoing[e.From], e)
+	}
+
+	// Breadth-first search from the target, recording every edge which
+	// reaches a package on a shortest path.
+	dist := map[string]int{target: 0}
+	parents := map[string][]DependencyEdge{}
+	queue := []string{target}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, e := range outgoing[current] {
+			d, seen := dist[e.To]
+			if !seen {
+				dist[e.To] = dist[current] + 1
+				queue = append(queue, e.To)
+			}
+			if !seen || d == dist[current]+1 {
+				parents[e.To] = append(parents[e.To], e)
+			}
+		}
+	}
+	if _, reachable := dist[pkg]; !reachable {
+		return nil, fmt.Errorf("package %q is not required by %q", pkg, target)
+	}
+
+	// Walk backwards from pkg to enumerate the shortest chains.
+	var out []WhyChain
+	var walk func(name string, suffix WhyChain)
+	walk = func(name string, suffix WhyChain) {
+		if len(out) >= maxWhyChains {
+			return
+		}
+		if name == target {
+			chain := make(WhyChain, len(suffix))
+			copy(chain, suffix)
+			out = append(out, chain)
+			return
+		}
+		for _, e := range parents[name] {
+			link := WhyLink{
+				Package:  e.From,
+				Version:  e.FromVersion,
+				Field:    e.Field,
+				Relation: e.Relation,
+			}
+			walk(e.From, append(WhyChain{link}, suffix...))
+		}
+	}
+	walk(pkg, WhyChain{{Package: pkg, Version: versions[pkg]}})
+	return out, nil
+}
+
+// graphTarget returns the name of the package in the install graph which
+// was installed for target, which may be a package name or a target
+// specification as accepted by ParseTargetSpec.
+func (p *PackageInfo) graphTarget(versions map[string]version.Version, target string) (string, bool) {
+	if _, ok := versions[target]; ok {
+		return target, true
+	}
+	req, err := ParseTargetSpec(target)
+	if err != nil {
+		return target, false
+	}
+	alternatives := []deb.Requirement{req}
+	if req.Kind == deb.OrCompositeRequirement {
+		alternatives = req.Children
+	}
+	for _, alt := range alternatives {
+		if alt.Kind != deb.PackageRelationRequirement {
+			continue
+		}
+		for _, key := range p.relationKeys(alt, "") {
+			if v, ok := versions[key]; ok {
+				if alt.VersionConstraint != nil {
+					if sat, err := alt.VersionConstraint.Satisfied(v); err != nil || !sat {
+						continue
+					}
+				}
+				return key, true
+			}
+		}
+	}
+	return target, false
+}
+
+// Why computes the install graph for target, and returns the chains of
+// requirements which cause pkg to be installed alongside it.
+func (p *PackageInfo) Why(target, pkg string, installed *PackageInfo) ([]WhyChain, error) {
+	graph, err := p.InstallGraph(target, installed)
+	if err != nil {
+		return nil, err
+	}
+	return p.WhyInstalled(graph, target, pkg)
+}
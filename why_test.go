@@ -0,0 +1,107 @@
+package debdep
+
+import (
+	"testing"
+
+	"github.com/twitchyliquid64/debdep/deb"
+
+	version "github.com/knqyf263/go-deb-version"
+)
+
+func TestWhy(t *testing.T) {
+	pkgInfo := &PackageInfo{
+		BinaryPackages: true,
+		Packages: map[string]map[version.Version]*deb.Paragraph{
+			"base":     makePkg(t, "base", []string{"1.9.2"}, "kek, meep (>= 1.0)"),
+			"kek":      makePkg(t, "kek", []string{"1.3.2"}, "swaggins"),
+			"meep":     makePkg(t, "meep", []string{"2.0.0"}, "swaggins | yolo"),
+			"yolo":     makePkg(t, "yolo", []string{"1"}, "swaggins"),
+			"swaggins": makePkg(t, "swaggins", []string{"2"}, ""),
+		},
+	}
+
+	chains, err := pkgInfo.Why("base", "swaggins", &PackageInfo{})
+	if err != nil {
+		t.Fatalf("Why() returned err: %v", err)
+	}
+	if len(chains) != 2 {
+		t.Fatalf("Expected 2 chains, got %d: %v", len(chains), chains)
+	}
+	for _, want := range []string{
+		"base (1.9.2) Depends: kek -> kek (1.3.2) Depends: swaggins -> swaggins (2)",
+		"base (1.9.2) Depends: meep (>= 1.0) -> meep (2.0.0) Depends: swaggins | yolo -> swaggins (2)",
+	} {
+		found := false
+		for _, c := range chains {
+			if c.String() == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Chain %q not present in %v", want, chains)
+		}
+	}
+}
+
+func TestWhyChosenAlternative(t *testing.T) {
+	pkgInfo := &PackageInfo{
+		BinaryPackages: true,
+		Packages: map[string]map[version.Version]*deb.Paragraph{
+			"t": makePkg(t, "t", []string{"1"}, "x, y"),
+			"x": makePkg(t, "x", []string{"1"}, "a | b"),
+			"y": makePkg(t, "y", []string{"1"}, "b"),
+			"a": makePkg(t, "a", []string{"1"}, ""),
+			"b": makePkg(t, "b", []string{"1"}, ""),
+		},
+	}
+
+	// x is satisfied by a, which the resolver chose, although b is also
+	// part of the graph.
+	chains, err := pkgInfo.Why("t", "b", &PackageInfo{})
+	if err != nil {
+		t.Fatalf("Why() returned err: %v", err)
+	}
+	if len(chains) != 1 || chains[0].String() != "t (1) Depends: y -> y (1) Depends: b -> b (1)" {
+		t.Errorf("Why() = %v, want only the chain through y", chains)
+	}
+}
+
+func TestWhyTargetSpec(t *testing.T) {
+	pkgInfo := &PackageInfo{
+		BinaryPackages: true,
+		Packages: map[string]map[version.Version]*deb.Paragraph{
+			"app": makePkg(t, "app", []string{"1", "2"}, "lib"),
+			"lib": makePkg(t, "lib", []string{"1"}, ""),
+		},
+	}
+
+	for _, target := range []string{"app (>= 1)", "app=1", "missing | app"} {
+		chains, err := pkgInfo.Why(target, "lib", &PackageInfo{})
+		if err != nil {
+			t.Errorf("Why(%q) returned err: %v", target, err)
+			continue
+		}
+		if len(chains) != 1 || chains[0][0].Package != "app" {
+			t.Errorf("Why(%q) = %v, want a chain from app", target, chains)
+		}
+	}
+	chains, err := pkgInfo.Why("app=1", "lib", &PackageInfo{})
+	if err == nil && chains[0][0].Version.String() != "1" {
+		t.Errorf("Why(app=1) chain starts at %v, want app (1)", chains[0][0])
+	}
+}
+
+func TestWhyNotRequired(t *testing.T) {
+	pkgInfo := &PackageInfo{
+		BinaryPackages: true,
+		Packages: map[string]map[version.Version]*deb.Paragraph{
+			"base": makePkg(t, "base", []string{"1.9.2"}, "kek"),
+			"kek":  makePkg(t, "kek", []string{"1.3.2"}, ""),
+			"meep": makePkg(t, "meep", []string{"2.0.0"}, ""),
+		},
+	}
+
+	if _, err := pkgInfo.Why("base", "meep", &PackageInfo{}); err == nil {
+		t.Error("Why() returned nil error for package outside the install graph")
+	}
+}